@@ -1,52 +1,221 @@
 package assignmentsystem
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"sync"
 	"time"
 )
 
+var (
+	ErrNoAvailableAgents    = errors.New("no available agents to take on work")
+	ErrOutsideBusinessHours = errors.New("account is outside business hours")
+	ErrUnknownAgent         = errors.New("unknown agent")
+	ErrUnknownAccount       = errors.New("unknown account")
+	ErrUnknownConversation  = errors.New("unknown conversation")
+	ErrNotAttempted         = errors.New("not attempted")
+	ErrConflictingLimits    = errors.New("conflicting limits for a shared agent")
+)
+
+// AgentStatus controls whether an agent is offered new conversations. Only
+// online agents are, the others keep the conversations they already hold.
+type AgentStatus int
+
+const (
+	AgentOnline  AgentStatus = iota
+	AgentAway                // On a break
+	AgentClosing             // Finishing up before the end of a shift
+	AgentOffline
+)
+
+// MarshalText writes the status by name, e.g. "away"
+func (status AgentStatus) MarshalText() ([]byte, error) {
+	return []byte(statusName(status)), nil
+}
+
+// UnmarshalText reads a status written by MarshalText
+func (status *AgentStatus) UnmarshalText(text []byte) error {
+	for _, candidate := range []AgentStatus{AgentOnline, AgentAway, AgentClosing, AgentOffline} {
+		if statusName(candidate) == string(text) {
+			*status = candidate
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown agent status %q", text)
+}
+
 type AgentWorkQueue struct {
 	Limit              int
 	AgentName          string
 	LastAssignmentTime *time.Time
 	Queue              []string
 	Account            string
+	Team               string
+	Accounts           []string       // Every account the agent works for when shared, Account is the first of them
+	AccountLimits      map[string]int // Optional per-account sub-limits within the shared Limit
+	AccountLoad        map[string]int // Conversations held per account, only tracked when AccountLimits is set
+	Status             AgentStatus
+	WrapUpUntil        []time.Time // Slots released by ended conversations that are still held for after-call work
+	LastCompletionTime *time.Time  // When the agent's last conversation ended
+	BusySince          *time.Time  // When the agent went from no conversations to at least one, nil while idle
+	BusyPeriods        []BusyPeriod
+	Assignments        int           // Conversations assigned since fairness tracking started
+	IdleTime           time.Duration // Time without a conversation since fairness tracking started, up to the last assignment
 }
 
 type AssignmentSystem struct {
-	accountAgents    map[string][]string
-	agentAssignments map[string]*AgentWorkQueue // Pointer to AgentWorkQueue because map access in golang yields a copy
+	accountAgents        map[string][]string
+	agentAssignments     map[string]*AgentWorkQueue // Pointer to AgentWorkQueue because map access in golang yields a copy
+	overflowChains       map[string][]OverflowTier
+	waitingConversations map[string][]waitingConversation
+	businessHours        map[string]BusinessHours
+	activeConversations  map[string]activeConversation
+	waitingAccounts      map[string]string   // Account of each waiting conversation by ID
+	conversationIndex    map[string][]string // Sorted IDs listed by ListConversations per account, dropped when conversations come or go
+	agentShifts          map[string]*shiftSchedule
+	wrapUpDurations      map[string]time.Duration
+	selectionModes       map[string]SelectionMode
+	shadows              map[string]*ShadowStats // Candidate selection modes evaluated alongside the live one
+	experiments          map[string]*experiment  // Accounts whose conversations are split between two selection modes
+	audit                *auditLog               // Set while decisions are being audited
+	batchMatchingLimit   int
+	parallelism          int
+	sharedAccountGroups  map[string]string // Accounts linked by shared agents, keyed to one representative account
+	stateMu              *sync.Mutex       // Guards activeConversations and waitingConversations while partitions run in parallel
+	now                  func() time.Time
+	trace                *traceRecorder // Set while a trace is being recorded
+	fairnessSince        time.Time      // When fairness tracking started, zero until the first assignment
 }
 
+type activeConversation struct {
+	AgentName string
+	Account   string
+	StartedAt time.Time
+}
+
+// AgentNameAndAccount describes an agent's membership of an account. An agent
+// shared between accounts appears once per account with the same Name, the
+// Limit of its first entry is shared across all of them and AccountLimit
+// optionally caps how much of it a single account can use. Later entries may
+// leave Limit at zero, a different non-zero Limit is a conflict that
+// ValidateRoster rejects and NewAssignmentSystem logs and ignores.
 type AgentNameAndAccount struct {
-	Name    string
-	Account string
-	Limit   int
+	Name         string `json:"name"`
+	Account      string `json:"account"`
+	Limit        int    `json:"limit,omitempty"`
+	Team         string `json:"team,omitempty"`
+	AccountLimit int    `json:"account_limit,omitempty"`
 }
 
 type ConversationToAssign struct {
-	ConversationID string
-	Account        string
+	ConversationID string `json:"conversation_id"`
+	Account        string `json:"account"`
+	CustomerID     string `json:"customer_id,omitempty"` // Optional, lets experiments keep a customer on one arm
 }
 
-type conversationAssignmentError struct {
+type ConversationAssignmentError struct {
 	ConversationToAssign
 	Err error
 }
 
+func (e ConversationAssignmentError) Error() string {
+	return fmt.Sprintf("conversation %s: %v", e.ConversationID, e.Err)
+}
+
+func (e ConversationAssignmentError) Unwrap() error {
+	return e.Err
+}
+
+// BatchAssignmentError is returned by Assign when some conversations in the
+// batch could not be assigned. Failures keeps the reason for each of them.
+type BatchAssignmentError struct {
+	Failures []ConversationAssignmentError
+}
+
+func (e *BatchAssignmentError) Error() string {
+	return fmt.Sprintf("failed to assign %d conversations", len(e.Failures))
+}
+
+// NotAttempted returns the conversations skipped because the context was done
+// before they were reached
+func (e *BatchAssignmentError) NotAttempted() []ConversationToAssign {
+	notAttempted := make([]ConversationToAssign, 0)
+	for _, failure := range e.Failures {
+		if errors.Is(failure.Err, ErrNotAttempted) {
+			notAttempted = append(notAttempted, failure.ConversationToAssign)
+		}
+	}
+
+	return notAttempted
+}
+
+// ValidateRoster checks that every entry of an agent listed more than once
+// agrees on its Limit, or leaves it at zero
+func ValidateRoster(roster []AgentNameAndAccount) error {
+	first := make(map[string]AgentNameAndAccount)
+	for _, entry := range roster {
+		firstEntry, seen := first[entry.Name]
+		if !seen {
+			first[entry.Name] = entry
+			continue
+		}
+		if entry.Limit != 0 && entry.Limit != firstEntry.Limit {
+			return fmt.Errorf("%w: %s has a limit of %d for %s and %d for %s",
+				ErrConflictingLimits, entry.Name, firstEntry.Limit, firstEntry.Account, entry.Limit, entry.Account)
+		}
+	}
+
+	return nil
+}
+
 func NewAssignmentSystem(initData []AgentNameAndAccount) AssignmentSystem {
 	assignmentsystem := AssignmentSystem{
-		accountAgents:    make(map[string][]string),
-		agentAssignments: make(map[string]*AgentWorkQueue),
+		accountAgents:        make(map[string][]string),
+		agentAssignments:     make(map[string]*AgentWorkQueue),
+		overflowChains:       make(map[string][]OverflowTier),
+		waitingConversations: make(map[string][]waitingConversation),
+		businessHours:        make(map[string]BusinessHours),
+		activeConversations:  make(map[string]activeConversation),
+		agentShifts:          make(map[string]*shiftSchedule),
+		wrapUpDurations:      make(map[string]time.Duration),
+		selectionModes:       make(map[string]SelectionMode),
+		stateMu:              &sync.Mutex{},
+		now:                  time.Now,
 	}
 
 	for _, nameAndAccount := range initData {
-		assignmentsystem.agentAssignments[nameAndAccount.Name] = &AgentWorkQueue{
-			AgentName: nameAndAccount.Name,
-			Limit:     nameAndAccount.Limit,
-			Queue:     make([]string, 0),
-			Account:   nameAndAccount.Account,
+		wq, exists := assignmentsystem.agentAssignments[nameAndAccount.Name]
+		if !exists {
+			wq = &AgentWorkQueue{
+				AgentName: nameAndAccount.Name,
+				Limit:     nameAndAccount.Limit,
+				Queue:     make([]string, 0),
+				Account:   nameAndAccount.Account,
+				Team:      nameAndAccount.Team,
+			}
+			assignmentsystem.agentAssignments[nameAndAccount.Name] = wq
+		} else if nameAndAccount.Limit != 0 && nameAndAccount.Limit != wq.Limit {
+			log.Printf("Ignoring limit %d of %s for %s, it keeps the limit %d of its first entry",
+				nameAndAccount.Limit, nameAndAccount.Name, nameAndAccount.Account, wq.Limit)
+		}
+
+		if nameAndAccount.AccountLimit > 0 {
+			if wq.AccountLimits == nil {
+				wq.AccountLimits = make(map[string]int)
+				wq.AccountLoad = make(map[string]int)
+			}
+			wq.AccountLimits[nameAndAccount.Account] = nameAndAccount.AccountLimit
+		}
+
+		// The same agent listed twice for one account is still a single member
+		if exists && slices.Contains(wq.memberAccounts(), nameAndAccount.Account) {
+			continue
+		}
+		if exists {
+			wq.Accounts = append(wq.memberAccounts(), nameAndAccount.Account)
 		}
 
 		if _, ok := assignmentsystem.accountAgents[nameAndAccount.Account]; !ok {
@@ -56,70 +225,233 @@ func NewAssignmentSystem(initData []AgentNameAndAccount) AssignmentSystem {
 		assignmentsystem.accountAgents[nameAndAccount.Account] = append(assignmentsystem.accountAgents[nameAndAccount.Account], nameAndAccount.Name)
 	}
 
+	assignmentsystem.groupSharedAccounts()
+
 	return assignmentsystem
 }
 
 func (as *AssignmentSystem) SetLimit(agentName string, limit int) {
+	as.traceOp(TraceRecord{Op: TraceSetLimit, AgentName: agentName, Limit: limit})
 	as.agentAssignments[agentName].Limit = limit
 }
 
+// SetStatus changes whether the agent is offered new conversations
+func (as *AssignmentSystem) SetStatus(agentName string, status AgentStatus) error {
+	wq, ok := as.agentAssignments[agentName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAgent, agentName)
+	}
+
+	as.traceOp(TraceRecord{Op: TraceSetStatus, AgentName: agentName, Status: status})
+	wq.Status = status
+	return nil
+}
+
+// Complete ends a conversation and frees its slot, after the account's wrap-up
+// time if one is configured.
+func (as *AssignmentSystem) Complete(conversationID string) error {
+	as.traceOp(TraceRecord{Op: TraceComplete, ConversationID: conversationID})
+	conversation, ok := as.activeConversations[conversationID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownConversation, conversationID)
+	}
+
+	wq := as.agentAssignments[conversation.AgentName]
+	wq.Queue = slices.DeleteFunc(wq.Queue, func(id string) bool { return id == conversationID })
+	if wq.AccountLoad != nil {
+		wq.AccountLoad[conversation.Account]--
+	}
+	delete(as.activeConversations, conversationID)
+	as.conversationIndex = nil
+	wq.recordCompletion(as.clock())
+
+	as.startWrapUp(wq, conversation.Account)
+	return nil
+}
+
+// SetClock replaces the time source used for assignment times and wait
+// thresholds. Tests use it to control time deterministically.
+func (as *AssignmentSystem) SetClock(now func() time.Time) {
+	as.now = now
+}
+
 func (as *AssignmentSystem) Assign(conversationsToAssign []ConversationToAssign) ([]string, error) {
+	return as.AssignContext(context.Background(), conversationsToAssign)
+}
+
+// AssignContext is Assign that stops once ctx is done. Conversations not
+// reached by then are left untouched and reported in the returned
+// BatchAssignmentError with ErrNotAttempted.
+func (as *AssignmentSystem) AssignContext(ctx context.Context, conversationsToAssign []ConversationToAssign) ([]string, error) {
 	log.Printf("Assigning %d conversatons", len(conversationsToAssign))
+	outcomes := as.assignBatch(ctx, conversationsToAssign)
+
+	return as.collectOutcomes(conversationsToAssign, outcomes)
+}
+
+// assignBatch works through the batch and returns what happened to each
+// conversation, in the order of the batch
+func (as *AssignmentSystem) assignBatch(ctx context.Context, conversationsToAssign []ConversationToAssign) []assignmentOutcome {
+	as.traceOp(TraceRecord{Op: TraceAssign, Conversations: conversationsToAssign})
+	as.startFairness()
+	outcomes := make([]assignmentOutcome, len(conversationsToAssign))
+
+	if as.parallelism > 1 {
+		as.assignPartitioned(ctx, conversationsToAssign, outcomes)
+	} else {
+		indexes := make([]int, len(conversationsToAssign))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		as.assignIndexes(ctx, conversationsToAssign, indexes, outcomes)
+	}
+
+	return outcomes
+}
+
+// assignIndexes processes the given conversations of the batch in order,
+// writing what happened to each into outcomes
+func (as *AssignmentSystem) assignIndexes(ctx context.Context, conversationsToAssign []ConversationToAssign, indexes []int, outcomes []assignmentOutcome) {
+	if as.batchMatchingLimit > 0 {
+		as.assignMatched(ctx, conversationsToAssign, indexes, outcomes)
+		return
+	}
+
+	for _, i := range indexes {
+		if ctx.Err() != nil {
+			outcomes[i] = notAttempted(ctx)
+			continue
+		}
+
+		outcomes[i] = as.assignOrWait(conversationsToAssign[i])
+	}
+}
+
+func notAttempted(ctx context.Context) assignmentOutcome {
+	return assignmentOutcome{Err: fmt.Errorf("%w: %w", ErrNotAttempted, ctx.Err())}
+}
+
+// assignmentOutcome is what happened to a single conversation of a batch
+type assignmentOutcome struct {
+	AgentName string
+	Err       error
+	Waiting   bool
+}
+
+func (as *AssignmentSystem) assignOrWait(conversation ConversationToAssign) assignmentOutcome {
+	as.serveWaitingFirst(conversation.Account)
+	assignment, err := as.assign(conversation, 0)
+	if as.shouldWait(conversation.Account, err) {
+		as.enqueueWaiting(conversation, errors.Is(err, ErrOutsideBusinessHours))
+		as.recordArrival(conversation, assignmentOutcome{Waiting: true})
+		return assignmentOutcome{Waiting: true}
+	}
+
+	outcome := assignmentOutcome{AgentName: assignment, Err: err}
+	as.recordArrival(conversation, outcome)
+	return outcome
+}
+
+func (as *AssignmentSystem) collectOutcomes(conversationsToAssign []ConversationToAssign, outcomes []assignmentOutcome) ([]string, error) {
 	assignedAgents := make([]string, 0)
-	failedAssignments := make([]conversationAssignmentError, 0)
-	for _, conversation := range conversationsToAssign {
-		assignment, err := as.assign(conversation)
-		if err != nil {
-			failedAssignments = append(failedAssignments, conversationAssignmentError{
-				conversation,
-				err,
+	failedAssignments := make([]ConversationAssignmentError, 0)
+	for i, outcome := range outcomes {
+		if outcome.Waiting {
+			continue
+		}
+
+		if outcome.Err != nil {
+			failedAssignments = append(failedAssignments, ConversationAssignmentError{
+				conversationsToAssign[i],
+				outcome.Err,
 			})
 
 			continue
 		}
 
-		assignedAgents = append(assignedAgents, assignment)
+		assignedAgents = append(assignedAgents, outcome.AgentName)
 	}
 
 	return assignedAgents, as.constructError(failedAssignments)
 }
 
-func (as *AssignmentSystem) constructError(failedAssignments []conversationAssignmentError) error {
+func (as *AssignmentSystem) constructError(failedAssignments []ConversationAssignmentError) error {
 	if len(failedAssignments) == 0 {
 		return nil
 	}
-	return fmt.Errorf("failed to assign %d conversations", len(failedAssignments))
+	return &BatchAssignmentError{Failures: failedAssignments}
 }
 
-func (as *AssignmentSystem) assign(conversation ConversationToAssign) (string, error) {
+func (as *AssignmentSystem) assign(conversation ConversationToAssign, waited time.Duration) (string, error) {
+	// Closed accounts don't take work regardless of agent capacity
+	if !as.isOpen(conversation.Account, as.clock()) {
+		as.auditDecision(conversation, waited, nil, nil, ErrOutsideBusinessHours)
+		return "", ErrOutsideBusinessHours
+	}
 	// Get all the AgentWorkQueue(s) that belong to this account and are not at their limit
-	eligibleWorkQueues := getEligibleAgentWorkQueues(as.accountAgents, as.agentAssignments, conversation.Account)
-	// If no agents are available either reject maybe use a fall back queue
+	eligibleWorkQueues := getEligibleAgentWorkQueues(as.accountAgents, as.agentAssignments, conversation.Account, as.clock())
+	// Narrow down to the teams the overflow chain allows after waiting this long
+	eligibleWorkQueues = filterWorkQueuesByTeams(eligibleWorkQueues, as.eligibleTeams(conversation.Account, waited))
+	// If no agents are available the caller decides between waiting and rejecting
 	if len(eligibleWorkQueues) == 0 {
-		// we need to make a decision here
-		return "", fmt.Errorf("no available agents to take on work")
+		as.auditDecision(conversation, waited, nil, nil, ErrNoAvailableAgents)
+		return "", ErrNoAvailableAgents
 	}
 	// Get the agents with least amount of work
-	workQueueWithLeastAmountOfWork := getWorkqueuesWithLeastAmountOfWork(eligibleWorkQueues)
-	// If one assign the the current case to then return
-	if len(workQueueWithLeastAmountOfWork) == 1 {
-		// Assign
-		return as.assignToWorkQueue(workQueueWithLeastAmountOfWork[0], conversation.ConversationID)
-	}
-	// more than one, pick the one with longest time.Now() - assignmentTime
-	withLeastRecentAssignment := getWorkQueueWithTheLeastRecentAssignment(workQueueWithLeastAmountOfWork)
-
-	return as.assignToWorkQueue(withLeastRecentAssignment, conversation.ConversationID)
+	workQueueWithLeastAmountOfWork := getWorkqueuesWithLeastAmountOfWork(eligibleWorkQueues, as.clock())
+	// Break any tie using the account's selection mode
+	chosen := as.selectWorkQueue(as.selectionMode(conversation), workQueueWithLeastAmountOfWork)
+	// Note what a shadowed candidate mode would have picked from the same state
+	as.compareShadow(conversation.Account, workQueueWithLeastAmountOfWork, chosen)
+	as.auditDecision(conversation, waited, workQueueWithLeastAmountOfWork, chosen, nil)
+
+	return as.assignToWorkQueue(chosen, conversation)
 }
 
-func (as *AssignmentSystem) assignToWorkQueue(wq *AgentWorkQueue, conversationID string) (string, error) {
-	wq.Queue = append(wq.Queue, conversationID)
-	assignmentTime := time.Now()
+func (as *AssignmentSystem) assignToWorkQueue(wq *AgentWorkQueue, conversation ConversationToAssign) (string, error) {
+	if len(wq.Queue) == 0 {
+		busySince := as.clock()
+		wq.BusySince = &busySince
+		wq.IdleTime += wq.currentIdle(as.fairnessSince, busySince)
+	}
+	wq.Assignments++
+	wq.Queue = append(wq.Queue, conversation.ConversationID)
+	if wq.AccountLoad != nil {
+		wq.AccountLoad[conversation.Account]++
+	}
+	assignmentTime := as.clock()
 	wq.LastAssignmentTime = &assignmentTime
+
+	as.stateMu.Lock()
+	if as.activeConversations == nil {
+		as.activeConversations = make(map[string]activeConversation)
+	}
+	as.activeConversations[conversation.ConversationID] = activeConversation{
+		AgentName: wq.AgentName,
+		Account:   conversation.Account,
+		StartedAt: assignmentTime,
+	}
+	as.conversationIndex = nil
+	as.stateMu.Unlock()
 	return wq.AgentName, nil
 }
 
-func getEligibleAgentWorkQueues(accountAgents map[string][]string, agentAssignments map[string]*AgentWorkQueue, account string) []*AgentWorkQueue {
+// memberAccounts returns every account the agent belongs to
+func (wq *AgentWorkQueue) memberAccounts() []string {
+	if len(wq.Accounts) == 0 {
+		return []string{wq.Account}
+	}
+	return wq.Accounts
+}
+
+func (as *AssignmentSystem) clock() time.Time {
+	if as.now == nil {
+		return time.Now()
+	}
+	return as.now()
+}
+
+func getEligibleAgentWorkQueues(accountAgents map[string][]string, agentAssignments map[string]*AgentWorkQueue, account string, now time.Time) []*AgentWorkQueue {
 	availableWorkQueues := make([]*AgentWorkQueue, 0)
 	agentsForAccount := accountAgents[account]
 
@@ -130,33 +462,58 @@ func getEligibleAgentWorkQueues(accountAgents map[string][]string, agentAssignme
 	}
 
 	for _, wq := range agentWqs {
-		if len(wq.Queue) == wq.Limit {
-			continue
+		if wq.exclusion(account, now) == "" {
+			availableWorkQueues = append(availableWorkQueues, wq)
 		}
-
-		availableWorkQueues = append(availableWorkQueues, wq)
 	}
 
 	return availableWorkQueues
 }
 
-func getWorkqueuesWithLeastAmountOfWork(workQueues []*AgentWorkQueue) []*AgentWorkQueue {
+// exclusion returns why the agent can't take another of the account's
+// conversations, or nothing if it can
+func (wq *AgentWorkQueue) exclusion(account string, now time.Time) ExclusionReason {
+	if wq.Status != AgentOnline {
+		return ExcludedUnavailable
+	}
+
+	// The limit may have been lowered below the current load by a shift change
+	if wq.load(now) >= wq.Limit {
+		return ExcludedAtLimit
+	}
+
+	// A shared agent can also be capped for this account specifically
+	if accountLimit, ok := wq.AccountLimits[account]; ok && wq.AccountLoad[account] >= accountLimit {
+		return ExcludedAtAccountLimit
+	}
+
+	return ""
+}
+
+// load is the agent's conversations plus the slots held for wrap-up, which
+// count as occupied
+func (wq *AgentWorkQueue) load(now time.Time) int {
+	return len(wq.Queue) + wq.slotsInWrapUp(now)
+}
+
+func getWorkqueuesWithLeastAmountOfWork(workQueues []*AgentWorkQueue, now time.Time) []*AgentWorkQueue {
 	if len(workQueues) == 0 {
 		return []*AgentWorkQueue{}
 	}
 
-	lowsestWorkload := len(workQueues[0].Queue)
+	lowsestWorkload := workQueues[0].load(now)
 	workQueuesFoundSoFar := make([]*AgentWorkQueue, 0)
 
 	for _, wq := range workQueues {
-		if len(wq.Queue) < lowsestWorkload {
+		load := wq.load(now)
+		if load < lowsestWorkload {
 			workQueuesFoundSoFar = make([]*AgentWorkQueue, 0)
 			workQueuesFoundSoFar = append(workQueuesFoundSoFar, wq)
-			lowsestWorkload = len(wq.Queue)
+			lowsestWorkload = load
 			continue
 		}
 
-		if len(wq.Queue) == lowsestWorkload {
+		if load == lowsestWorkload {
 			workQueuesFoundSoFar = append(workQueuesFoundSoFar, wq)
 		}
 	}
@@ -164,7 +521,10 @@ func getWorkqueuesWithLeastAmountOfWork(workQueues []*AgentWorkQueue) []*AgentWo
 	return workQueuesFoundSoFar
 }
 
-func getWorkQueueWithTheLeastRecentAssignment(workQueues []*AgentWorkQueue) *AgentWorkQueue {
+// getWorkQueueWithTheLeastRecentAssignment measures from the system's clock
+// rather than the wall clock, so it also works when the clock is virtual and
+// when several assignments happened at the same instant
+func getWorkQueueWithTheLeastRecentAssignment(workQueues []*AgentWorkQueue, now time.Time) *AgentWorkQueue {
 	var highestDuration time.Duration
 	var workQueueWithHighestDuration *AgentWorkQueue
 
@@ -174,9 +534,10 @@ func getWorkQueueWithTheLeastRecentAssignment(workQueues []*AgentWorkQueue) *Age
 			break
 		}
 
-		if time.Since(*wq.LastAssignmentTime) > highestDuration {
+		sinceLastAssignment := now.Sub(*wq.LastAssignmentTime)
+		if workQueueWithHighestDuration == nil || sinceLastAssignment > highestDuration {
 			workQueueWithHighestDuration = wq
-			highestDuration = time.Since(*wq.LastAssignmentTime)
+			highestDuration = sinceLastAssignment
 			continue
 		}
 	}
@@ -1,7 +1,13 @@
 package assignmentsystem
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,16 +20,19 @@ func NewAssignmentSystemWithState(agentAssignments map[string]*AgentWorkQueue) A
 	// Build the accountAgents map from the agentAssignments
 	accountAgents := make(map[string][]string)
 	for agentName, wq := range agentAssignments {
-		if _, exists := accountAgents[wq.Account]; !exists {
-			accountAgents[wq.Account] = make([]string, 0)
+		for _, account := range wq.memberAccounts() {
+			if _, exists := accountAgents[account]; !exists {
+				accountAgents[account] = make([]string, 0)
+			}
+			accountAgents[account] = append(accountAgents[account], agentName)
 		}
-		accountAgents[wq.Account] = append(accountAgents[wq.Account], agentName)
 	}
 
-	return AssignmentSystem{
-		accountAgents:    accountAgents,
-		agentAssignments: agentAssignments,
-	}
+	system := NewAssignmentSystem(nil)
+	system.accountAgents = accountAgents
+	system.agentAssignments = agentAssignments
+	system.groupSharedAccounts()
+	return system
 }
 
 func TestIntegrationAssignmentSystemBasicWorkflow(t *testing.T) {
@@ -163,6 +172,103 @@ func TestIntegrationAssignmentSystemAccountIsolation(t *testing.T) {
 	assert.Contains(t, []string{"agent1", "agent3"}, assignedAgents[2]) // account1
 }
 
+func TestIntegrationAssignmentSystemSharedAgentPool(t *testing.T) {
+	// Test that a shared agent serves both of its accounts from a single limit
+	initialData := []AgentNameAndAccount{
+		{Name: "shared1", Account: "account1", Limit: 3},
+		{Name: "shared1", Account: "account2", Limit: 3},
+		{Name: "agent2", Account: "account3", Limit: 3},
+	}
+
+	system := NewAssignmentSystem(initialData)
+
+	assert.Equal(t, []string{"shared1"}, system.accountAgents["account1"])
+	assert.Equal(t, []string{"shared1"}, system.accountAgents["account2"])
+	assert.Equal(t, []string{"account1", "account2"}, system.agentAssignments["shared1"].Accounts)
+
+	conversations := []ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+		{ConversationID: "conv2", Account: "account2"},
+		{ConversationID: "conv3", Account: "account1"},
+		{ConversationID: "conv4", Account: "account2"}, // Should fail - shared limit used up
+		{ConversationID: "conv5", Account: "account3"},
+	}
+
+	assignedAgents, err := system.Assign(conversations)
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"shared1", "shared1", "shared1", "agent2"}, assignedAgents)
+	assert.Len(t, system.agentAssignments["shared1"].Queue, 3)
+	// Tenants outside the pool remain isolated
+	assert.Len(t, system.agentAssignments["agent2"].Queue, 1)
+}
+
+func TestIntegrationAssignmentSystemSharedAgentAccountLimits(t *testing.T) {
+	// Test that per-account sub-limits are respected within the shared limit
+	initialData := []AgentNameAndAccount{
+		{Name: "shared1", Account: "account1", Limit: 4, AccountLimit: 1},
+		{Name: "shared1", Account: "account2", Limit: 4},
+		{Name: "agent2", Account: "account1", Limit: 1},
+	}
+
+	system := NewAssignmentSystem(initialData)
+
+	conversations := []ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+		{ConversationID: "conv2", Account: "account1"},
+		{ConversationID: "conv3", Account: "account1"}, // Should fail - shared1 capped for account1, agent2 full
+		{ConversationID: "conv4", Account: "account2"},
+		{ConversationID: "conv5", Account: "account2"},
+	}
+
+	assignedAgents, err := system.Assign(conversations)
+
+	assert.Error(t, err)
+	assert.Len(t, assignedAgents, 4)
+	assert.ElementsMatch(t, []string{"shared1", "agent2"}, assignedAgents[:2])
+	assert.Equal(t, []string{"shared1", "shared1"}, assignedAgents[2:])
+	assert.Equal(t, 1, system.agentAssignments["shared1"].AccountLoad["account1"])
+	assert.Equal(t, 2, system.agentAssignments["shared1"].AccountLoad["account2"])
+}
+
+func TestIntegrationAssignmentSystemDuplicateAgentEntries(t *testing.T) {
+	// Test that listing an agent twice for the same account doesn't duplicate it
+	initialData := []AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2},
+		{Name: "agent1", Account: "account1", Limit: 5},
+	}
+
+	system := NewAssignmentSystem(initialData)
+
+	assert.Equal(t, []string{"agent1"}, system.accountAgents["account1"])
+	assert.Equal(t, 2, system.agentAssignments["agent1"].Limit)
+}
+
+func TestIntegrationAssignmentSystemConflictingSharedLimits(t *testing.T) {
+	// Test that the first entry's limit wins and the conflict is reported
+	initialData := []AgentNameAndAccount{
+		{Name: "shared1", Account: "account1", Limit: 2},
+		{Name: "shared1", Account: "account2", Limit: 5},
+		{Name: "shared1", Account: "account3"},
+	}
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	system := NewAssignmentSystem(initialData)
+
+	assert.Equal(t, 2, system.agentAssignments["shared1"].Limit)
+	assert.Contains(t, logged.String(), "Ignoring limit 5 of shared1 for account2")
+	assert.Equal(t, 1, strings.Count(logged.String(), "Ignoring limit"))
+
+	err := ValidateRoster(initialData)
+	assert.ErrorIs(t, err, ErrConflictingLimits)
+	assert.Contains(t, err.Error(), "shared1 has a limit of 2 for account1 and 5 for account2")
+	assert.NoError(t, ValidateRoster(initialData[:1]))
+	assert.NoError(t, ValidateRoster([]AgentNameAndAccount{initialData[0], initialData[2]}))
+}
+
 func TestIntegrationAssignmentSystemAtCapacity(t *testing.T) {
 	// Test behavior when all agents are at capacity
 	initialData := []AgentNameAndAccount{
@@ -230,6 +336,33 @@ func TestIntegrationAssignmentSystemTimeBasedAssignment(t *testing.T) {
 	assert.Equal(t, "agent2", assignedAgents[0]) // Should choose agent2 (older assignment)
 }
 
+func TestIntegrationAssignmentSystemVirtualClock(t *testing.T) {
+	// Test that ties are broken on the system's clock, even when it is a
+	// virtual clock ahead of the wall clock
+	now := time.Now().Add(24 * time.Hour)
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2},
+		{Name: "agent2", Account: "account1", Limit: 2},
+	})
+	system.SetClock(func() time.Time { return now })
+
+	first, err := system.Assign([]ConversationToAssign{{ConversationID: "conv1", Account: "account1"}})
+	assert.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	second, err := system.Assign([]ConversationToAssign{{ConversationID: "conv2", Account: "account1"}})
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	// Both agents have one conversation, the one assigned longer ago wins
+	now = now.Add(time.Minute)
+	third, err := system.Assign([]ConversationToAssign{{ConversationID: "conv3", Account: "account1"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, first, third)
+}
+
 func TestIntegrationAssignmentSystemMixedScenarios(t *testing.T) {
 	// Test complex scenario with mixed states, different accounts, and various limits
 	now := time.Now()
@@ -284,3 +417,88 @@ func TestIntegrationAssignmentSystemMixedScenarios(t *testing.T) {
 	assert.Equal(t, "agent1", assignedAgents[1]) // Has room
 	assert.Equal(t, "agent3", assignedAgents[2]) // Empty queue
 }
+
+// cancelAfterChecks is a context that reports itself cancelled once Err has
+// been checked a number of times, to cancel part way through a batch
+type cancelAfterChecks struct {
+	context.Context
+	remaining int
+}
+
+func (c *cancelAfterChecks) Err() error {
+	if c.remaining <= 0 {
+		return context.Canceled
+	}
+	c.remaining--
+	return nil
+}
+
+func TestIntegrationAssignContextCancelledMidBatch(t *testing.T) {
+	// Test that conversations after cancellation are left untouched and reported
+	initialData := []AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 5},
+	}
+
+	system := NewAssignmentSystem(initialData)
+
+	conversations := []ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+		{ConversationID: "conv2", Account: "account1"},
+		{ConversationID: "conv3", Account: "account1"},
+	}
+
+	ctx := &cancelAfterChecks{Context: context.Background(), remaining: 1}
+	assignedAgents, err := system.AssignContext(ctx, conversations)
+
+	assert.Equal(t, []string{"agent1"}, assignedAgents)
+	assert.Len(t, system.agentAssignments["agent1"].Queue, 1)
+
+	var batchErr *BatchAssignmentError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, conversations[1:], batchErr.NotAttempted())
+	assert.ErrorIs(t, batchErr.Failures[0], context.Canceled)
+}
+
+func TestIntegrationAssignContextAlreadyCancelled(t *testing.T) {
+	// Test that a cancelled context attempts nothing, in parallel mode too
+	initialData := []AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 5},
+		{Name: "agent2", Account: "account2", Limit: 5},
+	}
+
+	system := NewAssignmentSystem(initialData)
+	system.SetParallelism(4)
+
+	conversations := []ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+		{ConversationID: "conv2", Account: "account2"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assignedAgents, err := system.AssignContext(ctx, conversations)
+
+	assert.Empty(t, assignedAgents)
+	assert.Empty(t, system.activeConversations)
+	assert.ErrorIs(t, err.(*BatchAssignmentError).Failures[0], ErrNotAttempted)
+	assert.Len(t, err.(*BatchAssignmentError).NotAttempted(), 2)
+}
+
+func TestIntegrationReevaluateWaitingContextCancelled(t *testing.T) {
+	// Test that cancelled reevaluation leaves the conversations waiting
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1, Team: "tier2"},
+	})
+	system.SetOverflowChain("account1", []OverflowTier{{Teams: []string{"tier1"}}, {After: time.Minute}})
+
+	_, err := system.Assign([]ConversationToAssign{{ConversationID: "conv1", Account: "account1"}})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assigned, err := system.ReevaluateWaitingContext(ctx)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, assigned)
+	assert.Len(t, system.waitingConversations["account1"], 1)
+}
@@ -179,7 +179,7 @@ func TestGettingEligibleAccounts(t *testing.T) {
 				accountAgents[wq.Account] = append(accountAgents[wq.Account], agentName)
 			}
 
-			accounts := getEligibleAgentWorkQueues(accountAgents, test.input, accountToSearch)
+			accounts := getEligibleAgentWorkQueues(accountAgents, test.input, accountToSearch, time.Now())
 			assert.ElementsMatch(t, accounts, test.expectation)
 		})
 	}
@@ -228,6 +228,14 @@ func TestGetWorkQueueWithTheLeastRecentAssignment(t *testing.T) {
 			input:       []*AgentWorkQueue{},
 			expectation: nil,
 		},
+		{
+			name: "All queues assigned at the current time",
+			input: []*AgentWorkQueue{
+				{LastAssignmentTime: &now},
+				{LastAssignmentTime: &now},
+			},
+			expectation: &AgentWorkQueue{LastAssignmentTime: &now},
+		},
 		{
 			name: "Mix of nil and non-nil assignment times - nil should be prioritized",
 			input: []*AgentWorkQueue{
@@ -323,7 +331,7 @@ func TestGetWorkQueueWithTheLeastRecentAssignment(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			result := getWorkQueueWithTheLeastRecentAssignment(test.input)
+			result := getWorkQueueWithTheLeastRecentAssignment(test.input, now)
 
 			// For nil comparison, we need to handle it specially
 			if test.expectation == nil {
@@ -346,6 +354,7 @@ func TestGetWorkQueueWithTheLeastRecentAssignment(t *testing.T) {
 }
 
 func TestGetWorkqueuesWithLeastAmountOfWork(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
 	tests := []struct {
 		name        string
 		input       []*AgentWorkQueue
@@ -443,11 +452,22 @@ func TestGetWorkqueuesWithLeastAmountOfWork(t *testing.T) {
 				{Queue: nil},
 			},
 		},
+		{
+			name: "Slots held for wrap-up count as work",
+			input: []*AgentWorkQueue{
+				{AgentName: "agent1", WrapUpUntil: []time.Time{now.Add(time.Minute), now.Add(time.Minute)}},
+				{AgentName: "agent2", Queue: []string{"item1"}},
+				{AgentName: "agent3", WrapUpUntil: []time.Time{now.Add(-time.Minute)}}, // Already over
+			},
+			expectation: []*AgentWorkQueue{
+				{AgentName: "agent3", WrapUpUntil: []time.Time{now.Add(-time.Minute)}},
+			},
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			result := getWorkqueuesWithLeastAmountOfWork(test.input)
+			result := getWorkqueuesWithLeastAmountOfWork(test.input, now)
 			assert.ElementsMatch(t, result, test.expectation)
 		})
 	}
@@ -0,0 +1,375 @@
+package assignmentsystem
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ExclusionReason is why an agent of the account wasn't considered for a
+// conversation
+type ExclusionReason string
+
+const (
+	ExcludedUnavailable    ExclusionReason = "unavailable"      // Away, closing or offline
+	ExcludedAtLimit        ExclusionReason = "at_limit"         // No free slot, counting those held for wrap-up
+	ExcludedAtAccountLimit ExclusionReason = "at_account_limit" // Shared agent at its limit for this account
+	ExcludedWrongTeam      ExclusionReason = "wrong_team"       // Not in a team the overflow chain allows yet
+)
+
+// DecisionCriterion is what picked the agent out of the eligible ones
+type DecisionCriterion string
+
+const (
+	CriterionLeastLoad             DecisionCriterion = "least_load" // One agent had less work than the rest
+	CriterionLeastRecentAssignment DecisionCriterion = "least_recent_assignment"
+	CriterionLongestIdle           DecisionCriterion = "longest_idle"
+	CriterionLowestOccupancy       DecisionCriterion = "lowest_occupancy"
+)
+
+// maxComparedAgents bounds how many of the tied agents a decision record
+// lists, idle accounts can have thousands of them
+const maxComparedAgents = 10
+
+// ComparedAgent is one of the agents with the least work and the value the
+// tie between them was broken on. Only the value the criterion uses is set.
+type ComparedAgent struct {
+	AgentName      string     `json:"agent_name"`
+	Conversations  int        `json:"conversations"`
+	WrapUpSlots    int        `json:"wrap_up_slots,omitempty"`
+	LastAssignment *time.Time `json:"last_assignment,omitempty"`
+	LastCompletion *time.Time `json:"last_completion,omitempty"`
+	Occupancy      *float64   `json:"occupancy,omitempty"`
+}
+
+// DecisionRecord explains one attempt to assign a conversation
+type DecisionRecord struct {
+	At             time.Time     `json:"at"`
+	ConversationID string        `json:"conversation_id"`
+	Account        string        `json:"account"`
+	Waited         time.Duration `json:"waited_ns"`
+
+	Agents   int                     `json:"agents"` // In the account, before anything is filtered out
+	Excluded map[ExclusionReason]int `json:"excluded,omitempty"`
+	Eligible int                     `json:"eligible"`
+	// Eligible agents sharing the least work, and how many conversations and
+	// slots held for wrap-up each of them had
+	LeastLoaded   int `json:"least_loaded"`
+	LeastWorkload int `json:"least_workload"`
+
+	Criterion DecisionCriterion `json:"criterion,omitempty"`
+	Compared  []ComparedAgent   `json:"compared,omitempty"` // The winner first, then the agents it beat
+	AgentName string            `json:"agent_name,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// AuditOptions configures the decision audit log
+type AuditOptions struct {
+	Path string
+	// Share of conversations audited, from 0 to 1. Conversations are picked by
+	// ID so every attempt to assign one is either logged or not.
+	SampleRate float64
+	// Size the file may grow to before it is rotated to Path.1, Path.1 to
+	// Path.2 and so on. Defaults to 64MB.
+	MaxBytes int64
+	// Rotated files kept, defaults to 5
+	MaxFiles int
+}
+
+// auditLog writes sampled decision records to a rotating file
+type auditLog struct {
+	mu       sync.Mutex
+	options  AuditOptions
+	file     *os.File
+	buffered *bufio.Writer
+	written  int64
+	err      error
+}
+
+// StartAudit starts logging a sample of assignment decisions: how many agents
+// the account had, how many each filter left out, how the winner was picked
+// and the values it was compared on. Failed attempts are logged too, and so
+// are conversations placed by batch matching. Only one audit log can be
+// written at a time.
+func (as *AssignmentSystem) StartAudit(options AuditOptions) error {
+	if as.audit != nil {
+		return fmt.Errorf("decisions are already being audited")
+	}
+	if options.Path == "" {
+		return fmt.Errorf("audit log needs a path")
+	}
+	if options.SampleRate < 0 || options.SampleRate > 1 {
+		return fmt.Errorf("audit sample rate must be between 0 and 1, got %v", options.SampleRate)
+	}
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = 64 << 20
+	}
+	if options.MaxFiles <= 0 {
+		options.MaxFiles = 5
+	}
+
+	al := &auditLog{options: options}
+	if err := al.open(); err != nil {
+		return err
+	}
+
+	as.audit = al
+	return nil
+}
+
+// StopAudit stops logging decisions and closes the file, returning the first
+// error hit while writing it
+func (as *AssignmentSystem) StopAudit() error {
+	al := as.audit
+	if al == nil {
+		return nil
+	}
+	as.audit = nil
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	return errors.Join(al.err, al.close())
+}
+
+// Decisions looks up the audited decisions about a conversation in the
+// current audit log, oldest first
+func (as *AssignmentSystem) Decisions(conversationID string) ([]DecisionRecord, error) {
+	al := as.audit
+	if al == nil {
+		return nil, fmt.Errorf("decisions are not being audited")
+	}
+
+	al.mu.Lock()
+	err := al.buffered.Flush()
+	al.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return FindDecisions(al.options.Path, conversationID)
+}
+
+// FindDecisions looks up the decisions about a conversation in the audit log
+// at path and the files rotated from it, oldest first
+func FindDecisions(path string, conversationID string) ([]DecisionRecord, error) {
+	rotated := make([]string, 0)
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(name); err != nil {
+			break
+		}
+		rotated = append(rotated, name)
+	}
+	slices.Reverse(rotated)
+
+	found := make([]DecisionRecord, 0)
+	for _, name := range append(rotated, path) {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+
+		decoder := json.NewDecoder(bufio.NewReader(file))
+		for decoder.More() {
+			var record DecisionRecord
+			if err := decoder.Decode(&record); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("reading %s: %w", name, err)
+			}
+			if record.ConversationID == conversationID {
+				found = append(found, record)
+			}
+		}
+		file.Close()
+	}
+
+	return found, nil
+}
+
+// auditDecision logs the decision about a conversation if decisions are being
+// audited and the conversation is sampled. It has to run before the chosen
+// agent is assigned to, so the values logged are the ones compared.
+func (as *AssignmentSystem) auditDecision(conversation ConversationToAssign, waited time.Duration, leastLoaded []*AgentWorkQueue, chosen *AgentWorkQueue, err error) {
+	al := as.audit
+	if al == nil || float64(hashBucket(conversation.ConversationID)) >= al.options.SampleRate*splitBuckets {
+		return
+	}
+
+	now := as.clock()
+	record := DecisionRecord{
+		At:             now,
+		ConversationID: conversation.ConversationID,
+		Account:        conversation.Account,
+		Waited:         waited,
+		Agents:         len(as.accountAgents[conversation.Account]),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	if !errors.Is(err, ErrOutsideBusinessHours) {
+		record.Excluded, record.Eligible = as.exclusions(conversation.Account, waited, now)
+	}
+
+	if chosen != nil {
+		record.LeastLoaded = len(leastLoaded)
+		record.LeastWorkload = chosen.load(now)
+		record.AgentName = chosen.AgentName
+		record.Criterion = CriterionLeastLoad
+		if len(leastLoaded) > 1 {
+			record.Criterion = criterionOf(as.selectionMode(conversation))
+		}
+		record.Compared = comparedAgents(record.Criterion, leastLoaded, chosen, now)
+	}
+
+	al.record(record)
+}
+
+// exclusions counts the account's agents each filter leaves out for a
+// conversation that has waited this long, and how many are left
+func (as *AssignmentSystem) exclusions(account string, waited time.Duration, now time.Time) (map[ExclusionReason]int, int) {
+	excluded := make(map[ExclusionReason]int)
+	teams := as.eligibleTeams(account, waited)
+	eligible := 0
+
+	for _, agentName := range as.accountAgents[account] {
+		wq := as.agentAssignments[agentName]
+		reason := wq.exclusion(account, now)
+		if reason == "" && teams != nil && !slices.Contains(teams, wq.Team) {
+			reason = ExcludedWrongTeam
+		}
+
+		if reason == "" {
+			eligible++
+			continue
+		}
+		excluded[reason]++
+	}
+
+	if len(excluded) == 0 {
+		return nil, eligible
+	}
+	return excluded, eligible
+}
+
+func criterionOf(mode SelectionMode) DecisionCriterion {
+	switch mode {
+	case SelectLongestIdle:
+		return CriterionLongestIdle
+	case SelectLowestOccupancy:
+		return CriterionLowestOccupancy
+	}
+	return CriterionLeastRecentAssignment
+}
+
+// comparedAgents lists the chosen agent and the first of the agents it was
+// tied with, with the values the criterion compared
+func comparedAgents(criterion DecisionCriterion, leastLoaded []*AgentWorkQueue, chosen *AgentWorkQueue, now time.Time) []ComparedAgent {
+	compared := []ComparedAgent{comparedAgent(criterion, chosen, now)}
+	for _, wq := range leastLoaded {
+		if len(compared) == maxComparedAgents {
+			break
+		}
+		if wq != chosen {
+			compared = append(compared, comparedAgent(criterion, wq, now))
+		}
+	}
+
+	return compared
+}
+
+func comparedAgent(criterion DecisionCriterion, wq *AgentWorkQueue, now time.Time) ComparedAgent {
+	agent := ComparedAgent{AgentName: wq.AgentName, Conversations: len(wq.Queue), WrapUpSlots: wq.slotsInWrapUp(now)}
+
+	switch criterion {
+	case CriterionLeastRecentAssignment:
+		agent.LastAssignment = wq.LastAssignmentTime
+	case CriterionLongestIdle:
+		agent.LastCompletion = wq.LastCompletionTime
+	case CriterionLowestOccupancy:
+		occupancy := wq.occupancy(now)
+		agent.Occupancy = &occupancy
+	}
+
+	return agent
+}
+
+func (al *auditLog) open() error {
+	file, err := os.OpenFile(al.options.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	al.file = file
+	al.buffered = bufio.NewWriter(file)
+	al.written = info.Size()
+	return nil
+}
+
+func (al *auditLog) close() error {
+	if err := al.buffered.Flush(); err != nil {
+		al.file.Close()
+		return err
+	}
+	return al.file.Close()
+}
+
+func (al *auditLog) record(record DecisionRecord) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	// The first error sticks and is reported by StopAudit
+	if al.err != nil {
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		al.err = err
+		return
+	}
+	line = append(line, '\n')
+
+	if al.written > 0 && al.written+int64(len(line)) > al.options.MaxBytes {
+		if al.err = al.rotate(); al.err != nil {
+			return
+		}
+	}
+
+	n, err := al.buffered.Write(line)
+	al.written += int64(n)
+	al.err = err
+}
+
+// rotate shifts the rotated files up by one, dropping the oldest, and starts
+// a new file
+func (al *auditLog) rotate() error {
+	if err := al.close(); err != nil {
+		return err
+	}
+
+	path := al.options.Path
+	for i := al.options.MaxFiles - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return err
+	}
+
+	return al.open()
+}
@@ -0,0 +1,246 @@
+package assignmentsystem
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrationAudit(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1, Team: "tier1"},
+		{Name: "agent2", Account: "account1", Limit: 2, Team: "tier2"},
+		{Name: "agent3", Account: "account1", Limit: 2, Team: "tier1"},
+		{Name: "agent4", Account: "account2", Limit: 1},
+		{Name: "agent5", Account: "account2", Limit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetOverflowChain("account1", []OverflowTier{{Teams: []string{"tier1"}}, {After: 30 * time.Second}})
+	assert.NoError(t, system.SetStatus("agent3", AgentAway))
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	assert.NoError(t, system.StartAudit(AuditOptions{Path: path, SampleRate: 1}))
+	assert.Error(t, system.StartAudit(AuditOptions{Path: path, SampleRate: 1}))
+
+	_, err := system.Assign([]ConversationToAssign{{ConversationID: "c1", Account: "account1"}})
+	assert.NoError(t, err)
+	_, err = system.Assign([]ConversationToAssign{{ConversationID: "c2", Account: "account1"}}) // Only tier1 for now, it waits
+	assert.NoError(t, err)
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, map[string]string{"c2": "agent2"}, system.ReevaluateWaiting())
+	_, err = system.Assign([]ConversationToAssign{{ConversationID: "c3", Account: "account2"}})
+	assert.NoError(t, err)
+
+	decisions, err := system.Decisions("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, []DecisionRecord{{
+		At:             time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC),
+		ConversationID: "c1",
+		Account:        "account1",
+		Agents:         3,
+		Excluded:       map[ExclusionReason]int{ExcludedUnavailable: 1, ExcludedWrongTeam: 1},
+		Eligible:       1,
+		LeastLoaded:    1,
+		Criterion:      CriterionLeastLoad,
+		Compared:       []ComparedAgent{{AgentName: "agent1"}},
+		AgentName:      "agent1",
+	}}, decisions)
+
+	// Every attempt is there, the failed one as well
+	decisions, err = system.Decisions("c2")
+	assert.NoError(t, err)
+	assert.Len(t, decisions, 2)
+	assert.Equal(t, ErrNoAvailableAgents.Error(), decisions[0].Error)
+	assert.Equal(t, map[ExclusionReason]int{ExcludedUnavailable: 1, ExcludedAtLimit: 1, ExcludedWrongTeam: 1}, decisions[0].Excluded)
+	assert.Zero(t, decisions[0].Eligible)
+	assert.Empty(t, decisions[0].AgentName)
+	assert.Equal(t, 30*time.Second, decisions[1].Waited)
+	assert.Equal(t, map[ExclusionReason]int{ExcludedUnavailable: 1, ExcludedAtLimit: 1}, decisions[1].Excluded)
+	assert.Equal(t, "agent2", decisions[1].AgentName)
+
+	// A tie broken by the least recent assignment lists both agents
+	decisions, err = system.Decisions("c3")
+	assert.NoError(t, err)
+	assert.Len(t, decisions, 1)
+	assert.Equal(t, 2, decisions[0].LeastLoaded)
+	assert.Equal(t, CriterionLeastRecentAssignment, decisions[0].Criterion)
+	assert.Equal(t, []ComparedAgent{{AgentName: "agent4"}, {AgentName: "agent5"}}, decisions[0].Compared)
+
+	assert.NoError(t, system.StopAudit())
+	_, err = system.Decisions("c3")
+	assert.Error(t, err)
+
+	// The log can still be searched once closed
+	decisions, err = FindDecisions(path, "c2")
+	assert.NoError(t, err)
+	assert.Len(t, decisions, 2)
+}
+
+func TestAuditComparedValues(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+		{Name: "agent2", Account: "account1", Limit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetSelectionMode("account1", SelectLowestOccupancy)
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	assert.NoError(t, system.StartAudit(AuditOptions{Path: path, SampleRate: 1}))
+
+	// agent1 is busy for 15 minutes of the last hour
+	_, err := system.Assign([]ConversationToAssign{{ConversationID: "c1", Account: "account1"}})
+	assert.NoError(t, err)
+	now = now.Add(15 * time.Minute)
+	assert.NoError(t, system.Complete("c1"))
+	now = now.Add(15 * time.Minute)
+
+	_, err = system.Assign([]ConversationToAssign{{ConversationID: "c2", Account: "account1"}})
+	assert.NoError(t, err)
+
+	decisions, err := system.Decisions("c2")
+	assert.NoError(t, err)
+	assert.Len(t, decisions, 1)
+	assert.Equal(t, CriterionLowestOccupancy, decisions[0].Criterion)
+	assert.Equal(t, "agent2", decisions[0].AgentName)
+	assert.Len(t, decisions[0].Compared, 2)
+	assert.InDelta(t, 0, *decisions[0].Compared[0].Occupancy, 1e-9)
+	assert.InDelta(t, 0.25, *decisions[0].Compared[1].Occupancy, 1e-9)
+	assert.NoError(t, system.StopAudit())
+}
+
+func TestAuditBatchMatching(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+		{Name: "agent2", Account: "account1", Limit: 2},
+		{Name: "agent3", Account: "account1", Limit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetBatchMatching(10)
+	assert.NoError(t, system.SetStatus("agent3", AgentAway))
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	assert.NoError(t, system.StartAudit(AuditOptions{Path: path, SampleRate: 1}))
+
+	_, err := system.Assign([]ConversationToAssign{
+		{ConversationID: "c1", Account: "account1"},
+		{ConversationID: "c2", Account: "account1"},
+		{ConversationID: "c3", Account: "account1"},
+		{ConversationID: "c4", Account: "account1"}, // Nobody left
+	})
+	assert.Error(t, err)
+
+	// Each decision is logged with the state it was made in
+	decisions, err := system.Decisions("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, []DecisionRecord{{
+		At:             now,
+		ConversationID: "c1",
+		Account:        "account1",
+		Agents:         3,
+		Excluded:       map[ExclusionReason]int{ExcludedUnavailable: 1},
+		Eligible:       2,
+		LeastLoaded:    2,
+		Criterion:      CriterionLeastRecentAssignment,
+		Compared:       []ComparedAgent{{AgentName: "agent1"}, {AgentName: "agent2"}},
+		AgentName:      "agent1",
+	}}, decisions)
+
+	decisions, err = system.Decisions("c2")
+	assert.NoError(t, err)
+	assert.Len(t, decisions, 1)
+	assert.Equal(t, map[ExclusionReason]int{ExcludedUnavailable: 1, ExcludedAtLimit: 1}, decisions[0].Excluded)
+	assert.Equal(t, CriterionLeastLoad, decisions[0].Criterion)
+	assert.Equal(t, "agent2", decisions[0].AgentName)
+
+	decisions, err = system.Decisions("c3")
+	assert.NoError(t, err)
+	assert.Len(t, decisions, 1)
+	assert.Equal(t, 1, decisions[0].LeastWorkload)
+	assert.Equal(t, "agent2", decisions[0].AgentName)
+
+	decisions, err = system.Decisions("c4")
+	assert.NoError(t, err)
+	assert.Len(t, decisions, 1)
+	assert.Equal(t, ErrNoAvailableAgents.Error(), decisions[0].Error)
+	assert.NoError(t, system.StopAudit())
+}
+
+func TestAuditSampling(t *testing.T) {
+	agents := make([]AgentNameAndAccount, 0)
+	for i := range 10 {
+		agents = append(agents, AgentNameAndAccount{Name: fmt.Sprintf("agent%d", i), Account: "account1", Limit: 1000})
+	}
+
+	for _, test := range []struct {
+		rate     float64
+		min, max int
+	}{
+		{rate: 0, min: 0, max: 0},
+		{rate: 0.1, min: 70, max: 130},
+		{rate: 1, min: 1000, max: 1000},
+	} {
+		t.Run(fmt.Sprint(test.rate), func(t *testing.T) {
+			system := NewAssignmentSystem(agents)
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			assert.NoError(t, system.StartAudit(AuditOptions{Path: path, SampleRate: test.rate}))
+
+			conversations := make([]ConversationToAssign, 1000)
+			for i := range conversations {
+				conversations[i] = ConversationToAssign{ConversationID: fmt.Sprintf("conversation-%d", i), Account: "account1"}
+			}
+			_, err := system.Assign(conversations)
+			assert.NoError(t, err)
+			assert.NoError(t, system.StopAudit())
+
+			data, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			logged := bytes.Count(data, []byte("\n"))
+			assert.GreaterOrEqual(t, logged, test.min)
+			assert.LessOrEqual(t, logged, test.max)
+		})
+	}
+}
+
+func TestAuditRotation(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1000}})
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	assert.NoError(t, system.StartAudit(AuditOptions{Path: path, SampleRate: 1, MaxBytes: 2000, MaxFiles: 2}))
+
+	for i := range 100 {
+		_, err := system.Assign([]ConversationToAssign{{ConversationID: fmt.Sprintf("conversation-%d", i), Account: "account1"}})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, system.StopAudit())
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(2000))
+	}
+	_, err := os.Stat(path + ".3")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// The oldest decisions were rotated away, recent ones are still found
+	decisions, err := FindDecisions(path, "conversation-0")
+	assert.NoError(t, err)
+	assert.Empty(t, decisions)
+	decisions, err = FindDecisions(path, "conversation-99")
+	assert.NoError(t, err)
+	assert.Len(t, decisions, 1)
+}
+
+func TestStartAuditValidation(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1}})
+
+	assert.Error(t, system.StartAudit(AuditOptions{SampleRate: 1}))
+	assert.Error(t, system.StartAudit(AuditOptions{Path: filepath.Join(t.TempDir(), "audit.jsonl"), SampleRate: 1.5}))
+	assert.NoError(t, system.StopAudit())
+}
@@ -0,0 +1,86 @@
+package assignmentsystem
+
+import (
+	"time"
+)
+
+// AfterHoursPolicy decides what happens to conversations arriving while an
+// account is closed.
+type AfterHoursPolicy int
+
+const (
+	// RejectAfterHours fails the conversation with ErrOutsideBusinessHours
+	RejectAfterHours AfterHoursPolicy = iota
+	// QueueAfterHours holds the conversation until the account opens again
+	QueueAfterHours
+)
+
+// OpeningHours is a window within a day, expressed as offsets from local
+// midnight, e.g. {Open: 9 * time.Hour, Close: 17 * time.Hour}.
+type OpeningHours struct {
+	Open  time.Duration
+	Close time.Duration
+}
+
+// BusinessHours is an account's weekly schedule in its own time zone. Days
+// missing from Weekly are closed, and Holidays close the account for the whole
+// calendar day they fall on (only the year, month and day are used).
+type BusinessHours struct {
+	Location   *time.Location
+	Weekly     map[time.Weekday][]OpeningHours
+	Holidays   []time.Time
+	AfterHours AfterHoursPolicy
+}
+
+// SetBusinessHours configures the schedule for an account. Accounts without
+// business hours are always open.
+func (as *AssignmentSystem) SetBusinessHours(account string, hours BusinessHours) {
+	if as.businessHours == nil {
+		as.businessHours = make(map[string]BusinessHours)
+	}
+
+	as.businessHours[account] = hours
+}
+
+// ClearBusinessHours makes the account open around the clock again
+func (as *AssignmentSystem) ClearBusinessHours(account string) {
+	delete(as.businessHours, account)
+}
+
+func (as *AssignmentSystem) isOpen(account string, at time.Time) bool {
+	hours, ok := as.businessHours[account]
+	if !ok {
+		return true
+	}
+
+	return hours.isOpen(at)
+}
+
+func (bh BusinessHours) isOpen(at time.Time) bool {
+	location := bh.Location
+	if location == nil {
+		location = time.UTC
+	}
+	local := at.In(location)
+
+	year, month, day := local.Date()
+	for _, holiday := range bh.Holidays {
+		holidayYear, holidayMonth, holidayDay := holiday.Date()
+		if year == holidayYear && month == holidayMonth && day == holidayDay {
+			return false
+		}
+	}
+
+	// Wall clock offset so daylight saving changes don't shift the schedule
+	sinceMidnight := time.Duration(local.Hour())*time.Hour +
+		time.Duration(local.Minute())*time.Minute +
+		time.Duration(local.Second())*time.Second
+
+	for _, window := range bh.Weekly[local.Weekday()] {
+		if sinceMidnight >= window.Open && sinceMidnight < window.Close {
+			return true
+		}
+	}
+
+	return false
+}
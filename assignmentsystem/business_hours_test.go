@@ -0,0 +1,135 @@
+package assignmentsystem
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBusinessHoursIsOpen(t *testing.T) {
+	newYork := time.FixedZone("EST", -5*60*60)
+	hours := BusinessHours{
+		Location: newYork,
+		Weekly: map[time.Weekday][]OpeningHours{
+			time.Monday: {
+				{Open: 9 * time.Hour, Close: 12 * time.Hour},
+				{Open: 13 * time.Hour, Close: 17 * time.Hour},
+			},
+			time.Tuesday: {{Open: 9 * time.Hour, Close: 17 * time.Hour}},
+		},
+		Holidays: []time.Time{time.Date(2025, 1, 7, 0, 0, 0, 0, time.UTC)},
+	}
+
+	tests := []struct {
+		name        string
+		at          time.Time
+		expectation bool
+	}{
+		{
+			name:        "Within the morning window",
+			at:          time.Date(2025, 1, 6, 9, 0, 0, 0, newYork),
+			expectation: true,
+		},
+		{
+			name:        "Lunch break between windows",
+			at:          time.Date(2025, 1, 6, 12, 30, 0, 0, newYork),
+			expectation: false,
+		},
+		{
+			name:        "Closing time is exclusive",
+			at:          time.Date(2025, 1, 6, 17, 0, 0, 0, newYork),
+			expectation: false,
+		},
+		{
+			name:        "Converted from UTC into the account's time zone",
+			at:          time.Date(2025, 1, 6, 15, 0, 0, 0, time.UTC), // 10:00 in New York
+			expectation: true,
+		},
+		{
+			name:        "Open in UTC but not yet in the account's time zone",
+			at:          time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC), // 05:00 in New York
+			expectation: false,
+		},
+		{
+			name:        "Holiday closes the whole day",
+			at:          time.Date(2025, 1, 7, 10, 0, 0, 0, newYork),
+			expectation: false,
+		},
+		{
+			name:        "Day without a schedule is closed",
+			at:          time.Date(2025, 1, 8, 10, 0, 0, 0, newYork),
+			expectation: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectation, hours.isOpen(test.at))
+		})
+	}
+}
+
+func TestIntegrationBusinessHoursReject(t *testing.T) {
+	now := time.Date(2025, 1, 6, 20, 0, 0, 0, time.UTC) // Monday evening
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 5},
+		{Name: "agent2", Account: "account2", Limit: 5},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetBusinessHours("account1", BusinessHours{
+		Weekly: map[time.Weekday][]OpeningHours{
+			time.Monday: {{Open: 9 * time.Hour, Close: 17 * time.Hour}},
+		},
+	})
+
+	assignedAgents, err := system.Assign([]ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+		{ConversationID: "conv2", Account: "account2"},
+	})
+
+	// account2 has no schedule and keeps working around the clock
+	assert.Equal(t, []string{"agent2"}, assignedAgents)
+
+	var batchErr *BatchAssignmentError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.Len(t, batchErr.Failures, 1)
+	assert.Equal(t, "conv1", batchErr.Failures[0].ConversationID)
+	assert.ErrorIs(t, batchErr.Failures[0], ErrOutsideBusinessHours)
+}
+
+func TestIntegrationBusinessHoursQueue(t *testing.T) {
+	now := time.Date(2025, 1, 6, 7, 0, 0, 0, time.UTC) // Monday before opening
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 5},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetBusinessHours("account1", BusinessHours{
+		Weekly: map[time.Weekday][]OpeningHours{
+			time.Monday: {{Open: 9 * time.Hour, Close: 17 * time.Hour}},
+		},
+		AfterHours: QueueAfterHours,
+	})
+	system.SetOverflowChain("account1", []OverflowTier{
+		{Teams: []string{"tier1"}},
+		{After: 30 * time.Minute},
+	})
+
+	assignedAgents, err := system.Assign([]ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+	})
+
+	assert.NoError(t, err)
+	assert.Empty(t, assignedAgents)
+	assert.Empty(t, system.ReevaluateWaiting())
+
+	// At opening the wait starts, so the overnight hours don't count towards escalation
+	now = time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	assert.Empty(t, system.ReevaluateWaiting())
+
+	now = now.Add(30 * time.Minute)
+	assert.Equal(t, map[string]string{"conv1": "agent1"}, system.ReevaluateWaiting())
+}
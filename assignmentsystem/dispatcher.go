@@ -0,0 +1,152 @@
+package assignmentsystem
+
+import (
+	"context"
+	"time"
+)
+
+// AssignmentResult is what happened to a single conversation
+type AssignmentResult struct {
+	ConversationToAssign
+	AgentName string
+	Waiting   bool // Held by an overflow chain or after-hours queue rather than assigned
+	Err       error
+	Received  time.Time // When a Dispatcher took the conversation in, zero outside of one
+}
+
+// DispatchedBatch is one micro-batch processed by a Dispatcher
+type DispatchedBatch struct {
+	Number   int
+	Results  []AssignmentResult
+	Started  time.Time
+	Duration time.Duration
+}
+
+// Err returns a BatchAssignmentError for the conversations that failed, the
+// same as Assign would have for this batch, or nil if none did
+func (b DispatchedBatch) Err() error {
+	failedAssignments := make([]ConversationAssignmentError, 0)
+	for _, result := range b.Results {
+		if result.Err != nil {
+			failedAssignments = append(failedAssignments, ConversationAssignmentError{result.ConversationToAssign, result.Err})
+		}
+	}
+
+	if len(failedAssignments) == 0 {
+		return nil
+	}
+	return &BatchAssignmentError{Failures: failedAssignments}
+}
+
+// AssignResults assigns like AssignContext but reports what happened to each
+// conversation, in the order they were given
+func (as *AssignmentSystem) AssignResults(ctx context.Context, conversationsToAssign []ConversationToAssign) []AssignmentResult {
+	outcomes := as.assignBatch(ctx, conversationsToAssign)
+
+	results := make([]AssignmentResult, len(conversationsToAssign))
+	for i, outcome := range outcomes {
+		results[i] = AssignmentResult{
+			ConversationToAssign: conversationsToAssign[i],
+			AgentName:            outcome.AgentName,
+			Waiting:              outcome.Waiting,
+			Err:                  outcome.Err,
+		}
+	}
+
+	return results
+}
+
+// Dispatcher feeds conversations arriving on a channel into an
+// AssignmentSystem in micro-batches. A batch is sent once it reaches
+// maxBatchSize or maxBatchDelay after its first conversation arrived,
+// whichever comes first. Batches must be read from Results for the dispatcher
+// to make progress.
+type Dispatcher struct {
+	system        *AssignmentSystem
+	input         <-chan ConversationToAssign
+	results       chan DispatchedBatch
+	maxBatchSize  int
+	maxBatchDelay time.Duration
+	batchNumber   int
+}
+
+func NewDispatcher(system *AssignmentSystem, input <-chan ConversationToAssign, maxBatchSize int, maxBatchDelay time.Duration) *Dispatcher {
+	return &Dispatcher{
+		system:        system,
+		input:         input,
+		results:       make(chan DispatchedBatch, 1),
+		maxBatchSize:  max(maxBatchSize, 1),
+		maxBatchDelay: maxBatchDelay,
+	}
+}
+
+// Results emits every processed batch and is closed once Run returns
+func (d *Dispatcher) Results() <-chan DispatchedBatch {
+	return d.results
+}
+
+// Run batches conversations until the input channel is closed or ctx is done.
+// Either way the conversations already received are still assigned before it
+// returns, only intake stops. It returns ctx's error if that is what stopped it.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	defer close(d.results)
+
+	batch := make([]ConversationToAssign, 0, d.maxBatchSize)
+	received := make([]time.Time, 0, d.maxBatchSize)
+	timer := time.NewTimer(d.maxBatchDelay)
+	timer.Stop()
+
+	flush := func(ctx context.Context) {
+		timer.Stop()
+		if len(batch) == 0 {
+			return
+		}
+
+		d.dispatch(ctx, batch, received)
+		batch = make([]ConversationToAssign, 0, d.maxBatchSize)
+		received = make([]time.Time, 0, d.maxBatchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Drain what was already taken in even though ctx is done
+			flush(context.WithoutCancel(ctx))
+			return ctx.Err()
+		case conversation, ok := <-d.input:
+			if !ok {
+				flush(ctx)
+				return nil
+			}
+
+			batch = append(batch, conversation)
+			received = append(received, time.Now())
+			if len(batch) == 1 {
+				timer.Reset(d.maxBatchDelay)
+			}
+			if len(batch) >= d.maxBatchSize {
+				flush(ctx)
+			}
+		case <-timer.C:
+			flush(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, batch []ConversationToAssign, received []time.Time) {
+	d.batchNumber++
+	started := time.Now()
+	results := d.system.AssignResults(ctx, batch)
+	duration := time.Since(started)
+
+	for i := range results {
+		results[i].Received = received[i]
+	}
+
+	d.results <- DispatchedBatch{
+		Number:   d.batchNumber,
+		Results:  results,
+		Started:  started,
+		Duration: duration,
+	}
+}
@@ -0,0 +1,105 @@
+package assignmentsystem
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectBatches(dispatcher *Dispatcher) chan []DispatchedBatch {
+	collected := make(chan []DispatchedBatch, 1)
+	go func() {
+		batches := make([]DispatchedBatch, 0)
+		for batch := range dispatcher.Results() {
+			batches = append(batches, batch)
+		}
+		collected <- batches
+	}()
+
+	return collected
+}
+
+func TestIntegrationDispatcherBatchesBySize(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 10},
+	})
+
+	input := make(chan ConversationToAssign)
+	dispatcher := NewDispatcher(&system, input, 2, time.Hour)
+	collected := collectBatches(dispatcher)
+
+	go func() {
+		for i := range 5 {
+			input <- ConversationToAssign{ConversationID: fmt.Sprintf("conv%d", i+1), Account: "account1"}
+		}
+		close(input)
+	}()
+
+	assert.NoError(t, dispatcher.Run(context.Background()))
+	batches := <-collected
+
+	// Two full batches, then the remainder is drained when the input closes
+	assert.Len(t, batches, 3)
+	assert.Len(t, batches[0].Results, 2)
+	assert.Len(t, batches[1].Results, 2)
+	assert.Len(t, batches[2].Results, 1)
+	assert.Equal(t, 3, batches[2].Number)
+	assert.Equal(t, "conv5", batches[2].Results[0].ConversationID)
+	assert.Equal(t, "agent1", batches[2].Results[0].AgentName)
+	assert.False(t, batches[2].Results[0].Received.After(batches[2].Started))
+	assert.NoError(t, batches[2].Err())
+}
+
+func TestIntegrationDispatcherBatchesByTime(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+	})
+
+	input := make(chan ConversationToAssign)
+	dispatcher := NewDispatcher(&system, input, 100, 10*time.Millisecond)
+	collected := collectBatches(dispatcher)
+
+	go func() {
+		input <- ConversationToAssign{ConversationID: "conv1", Account: "account1"}
+		input <- ConversationToAssign{ConversationID: "conv2", Account: "account1"}
+		// Long enough for the first batch to go out on its own
+		time.Sleep(50 * time.Millisecond)
+		input <- ConversationToAssign{ConversationID: "conv3", Account: "account1"}
+		close(input)
+	}()
+
+	assert.NoError(t, dispatcher.Run(context.Background()))
+	batches := <-collected
+
+	assert.Len(t, batches, 2)
+	assert.Len(t, batches[0].Results, 2)
+	assert.ErrorIs(t, batches[0].Results[1].Err, ErrNoAvailableAgents)
+	assert.Error(t, batches[0].Err())
+	assert.Len(t, batches[1].Results, 1)
+}
+
+func TestIntegrationDispatcherDrainsOnCancel(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 10},
+	})
+
+	input := make(chan ConversationToAssign)
+	dispatcher := NewDispatcher(&system, input, 100, time.Hour)
+	collected := collectBatches(dispatcher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		input <- ConversationToAssign{ConversationID: "conv1", Account: "account1"}
+		cancel()
+	}()
+
+	assert.ErrorIs(t, dispatcher.Run(ctx), context.Canceled)
+	batches := <-collected
+
+	// The conversation already taken in is still assigned
+	assert.Len(t, batches, 1)
+	assert.Equal(t, "agent1", batches[0].Results[0].AgentName)
+}
@@ -0,0 +1,282 @@
+package assignmentsystem
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"maps"
+	"slices"
+	"time"
+)
+
+// ExperimentArm is the side of an experiment a conversation falls on
+type ExperimentArm string
+
+const (
+	ArmControl   ExperimentArm = "control"
+	ArmTreatment ExperimentArm = "treatment"
+)
+
+// splitBuckets is how finely conversations are split, hundredths of a percent
+const splitBuckets = 10000
+
+// Experiment splits an account's conversations between two selection modes
+type Experiment struct {
+	// Salts the split, so a new experiment on the same account puts
+	// conversations on different arms than the last one
+	Name      string        `json:"name"`
+	Control   SelectionMode `json:"control"`
+	Treatment SelectionMode `json:"treatment"`
+	// Share of conversations given to the treatment, from 0 to 100
+	TreatmentPercent float64 `json:"treatment_percent"`
+	// Split on CustomerID instead of ConversationID so all of a customer's
+	// conversations get the same mode. Conversations without a CustomerID
+	// fall back to their ConversationID.
+	ByCustomer bool `json:"by_customer"`
+}
+
+// ArmResults is how the conversations on one arm of an experiment fared
+type ArmResults struct {
+	Arm  ExperimentArm `json:"arm"`
+	Mode SelectionMode `json:"mode"`
+
+	Conversations int `json:"conversations"` // Arrived since the experiment started
+	Assigned      int `json:"assigned"`
+	Failed        int `json:"failed"`
+	Waiting       int `json:"waiting"` // Still waiting for an agent
+	// Failed over the conversations that either failed or were assigned
+	FailureRate float64 `json:"failure_rate"`
+
+	// Wait of the assigned conversations, zero for those assigned on arrival
+	MeanWait time.Duration `json:"mean_wait_ns"`
+	MaxWait  time.Duration `json:"max_wait_ns"`
+
+	// Gini coefficient of the arm's assignments per unit of Limit across the
+	// account's agents, as in FairnessReport
+	Gini float64 `json:"gini"`
+}
+
+// ExperimentResults compares the two arms of an account's experiment
+type ExperimentResults struct {
+	Account    string     `json:"account"`
+	Experiment Experiment `json:"experiment"`
+	Since      time.Time  `json:"since"`
+	Control    ArmResults `json:"control"`
+	Treatment  ArmResults `json:"treatment"`
+}
+
+type experiment struct {
+	Experiment
+	since time.Time
+	arms  map[ExperimentArm]*armTally
+}
+
+type armTally struct {
+	conversations, assigned, failed, waiting int
+	totalWait, maxWait                       time.Duration
+	agentAssignments                         map[string]int
+}
+
+// SetExperiment splits the account's conversations between the experiment's
+// two selection modes, overriding SetSelectionMode for the account. Which arm
+// a conversation falls on only depends on the experiment's name and the
+// conversation's ID, or customer ID, so it is the same every time it is
+// assigned, including after waiting. Setting an experiment starts its results
+// afresh.
+func (as *AssignmentSystem) SetExperiment(account string, e Experiment) error {
+	if e.TreatmentPercent < 0 || e.TreatmentPercent > 100 {
+		return fmt.Errorf("%s: treatment percent must be between 0 and 100, got %v", account, e.TreatmentPercent)
+	}
+
+	if as.experiments == nil {
+		as.experiments = make(map[string]*experiment)
+	}
+
+	as.experiments[account] = &experiment{
+		Experiment: e,
+		since:      as.clock(),
+		arms: map[ExperimentArm]*armTally{
+			ArmControl:   {agentAssignments: make(map[string]int)},
+			ArmTreatment: {agentAssignments: make(map[string]int)},
+		},
+	}
+
+	return nil
+}
+
+// ClearExperiment ends the account's experiment and drops its results. The
+// account goes back to its own selection mode.
+func (as *AssignmentSystem) ClearExperiment(account string) {
+	delete(as.experiments, account)
+}
+
+// ExperimentArmOf returns the arm a conversation falls on, or false if its
+// account has no experiment
+func (as *AssignmentSystem) ExperimentArmOf(conversation ConversationToAssign) (ExperimentArm, bool) {
+	e, ok := as.experiments[conversation.Account]
+	if !ok {
+		return "", false
+	}
+
+	return e.armOf(conversation), true
+}
+
+// ExperimentResults returns how the arms of the account's experiment compare
+// so far, or false if it has none
+func (as *AssignmentSystem) ExperimentResults(account string) (ExperimentResults, bool) {
+	e, ok := as.experiments[account]
+	if !ok {
+		return ExperimentResults{}, false
+	}
+
+	return as.experimentResults(account, e), true
+}
+
+// ExperimentResultsByAccount returns the results of every experiment in
+// account name order
+func (as *AssignmentSystem) ExperimentResultsByAccount() []ExperimentResults {
+	all := make([]ExperimentResults, 0, len(as.experiments))
+	for _, account := range slices.Sorted(maps.Keys(as.experiments)) {
+		all = append(all, as.experimentResults(account, as.experiments[account]))
+	}
+
+	return all
+}
+
+// WriteExperimentResults writes the results of every experiment to w as JSON
+// lines, one per account in name order
+func (as *AssignmentSystem) WriteExperimentResults(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+
+	for _, results := range as.ExperimentResultsByAccount() {
+		if err := encoder.Encode(results); err != nil {
+			return err
+		}
+	}
+
+	return buffered.Flush()
+}
+
+// selectionMode is the mode that breaks ties for the conversation, its
+// experiment arm's if the account has one
+func (as *AssignmentSystem) selectionMode(conversation ConversationToAssign) SelectionMode {
+	e, ok := as.experiments[conversation.Account]
+	if !ok {
+		return as.selectionModes[conversation.Account]
+	}
+
+	if e.armOf(conversation) == ArmTreatment {
+		return e.Treatment
+	}
+	return e.Control
+}
+
+// recordArrival counts a conversation's first attempt towards its arm
+func (as *AssignmentSystem) recordArrival(conversation ConversationToAssign, outcome assignmentOutcome) {
+	e, ok := as.experiments[conversation.Account]
+	if !ok {
+		return
+	}
+
+	tally := e.arms[e.armOf(conversation)]
+	tally.conversations++
+	switch {
+	case outcome.Waiting:
+		tally.waiting++
+	case outcome.Err != nil:
+		tally.failed++
+	default:
+		tally.assigned++
+		tally.agentAssignments[outcome.AgentName]++
+	}
+}
+
+// recordDequeue counts a waiting conversation being assigned towards its arm
+func (as *AssignmentSystem) recordDequeue(conversation ConversationToAssign, agentName string, waited time.Duration) {
+	e, ok := as.experiments[conversation.Account]
+	if !ok {
+		return
+	}
+
+	tally := e.arms[e.armOf(conversation)]
+	if tally.waiting == 0 {
+		return // Started waiting before the experiment did
+	}
+	tally.waiting--
+	tally.assigned++
+	tally.agentAssignments[agentName]++
+	tally.totalWait += waited
+	tally.maxWait = max(tally.maxWait, waited)
+}
+
+func (e *experiment) armOf(conversation ConversationToAssign) ExperimentArm {
+	key := conversation.ConversationID
+	if e.ByCustomer && conversation.CustomerID != "" {
+		key = conversation.CustomerID
+	}
+
+	if float64(hashBucket(e.Name, key)) < e.TreatmentPercent*splitBuckets/100 {
+		return ArmTreatment
+	}
+	return ArmControl
+}
+
+// hashBucket spreads keys evenly over splitBuckets, the same key always
+// landing in the same bucket
+func hashBucket(parts ...string) uint64 {
+	hash := fnv.New64a()
+	for i, part := range parts {
+		if i > 0 {
+			hash.Write([]byte{0})
+		}
+		hash.Write([]byte(part))
+	}
+
+	return hash.Sum64() % splitBuckets
+}
+
+func (as *AssignmentSystem) experimentResults(account string, e *experiment) ExperimentResults {
+	return ExperimentResults{
+		Account:    account,
+		Experiment: e.Experiment,
+		Since:      e.since,
+		Control:    as.armResults(account, ArmControl, e.Control, e.arms[ArmControl]),
+		Treatment:  as.armResults(account, ArmTreatment, e.Treatment, e.arms[ArmTreatment]),
+	}
+}
+
+func (as *AssignmentSystem) armResults(account string, arm ExperimentArm, mode SelectionMode, tally *armTally) ArmResults {
+	results := ArmResults{
+		Arm:           arm,
+		Mode:          mode,
+		Conversations: tally.conversations,
+		Assigned:      tally.assigned,
+		Failed:        tally.failed,
+		Waiting:       tally.waiting,
+		MaxWait:       tally.maxWait,
+	}
+
+	if settled := tally.assigned + tally.failed; settled > 0 {
+		results.FailureRate = float64(tally.failed) / float64(settled)
+	}
+	if tally.assigned > 0 {
+		results.MeanWait = tally.totalWait / time.Duration(tally.assigned)
+	}
+
+	perLimit := make([]float64, 0, len(as.accountAgents[account]))
+	for _, agentName := range as.accountAgents[account] {
+		wq := as.agentAssignments[agentName]
+		if wq == nil || wq.Limit <= 0 {
+			continue
+		}
+		perLimit = append(perLimit, float64(tally.agentAssignments[agentName])/float64(wq.Limit))
+	}
+	if len(perLimit) > 0 {
+		results.Gini = gini(perLimit)
+	}
+
+	return results
+}
@@ -0,0 +1,184 @@
+package assignmentsystem
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// conversationsOnArm returns the first n conversation IDs of the account that
+// fall on the arm
+func conversationsOnArm(system *AssignmentSystem, account string, arm ExperimentArm, n int) []ConversationToAssign {
+	conversations := make([]ConversationToAssign, 0, n)
+	for i := 1; len(conversations) < n; i++ {
+		conversation := ConversationToAssign{ConversationID: fmt.Sprintf("%s-%d", arm, i), Account: account}
+		if got, _ := system.ExperimentArmOf(conversation); got == arm {
+			conversations = append(conversations, conversation)
+		}
+	}
+	return conversations
+}
+
+func TestExperimentSplit(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1}})
+
+	_, ok := system.ExperimentArmOf(ConversationToAssign{ConversationID: "c1", Account: "account1"})
+	assert.False(t, ok)
+
+	tests := []struct {
+		name             string
+		treatmentPercent float64
+		minTreatment     int
+		maxTreatment     int
+	}{
+		{name: "Nothing on the treatment", treatmentPercent: 0, minTreatment: 0, maxTreatment: 0},
+		{name: "Half and half", treatmentPercent: 50, minTreatment: 4800, maxTreatment: 5200},
+		{name: "A tenth", treatmentPercent: 10, minTreatment: 900, maxTreatment: 1100},
+		{name: "Everything on the treatment", treatmentPercent: 100, minTreatment: 10000, maxTreatment: 10000},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.NoError(t, system.SetExperiment("account1", Experiment{Name: "split", TreatmentPercent: test.treatmentPercent}))
+
+			treatment := 0
+			for i := range 10000 {
+				conversation := ConversationToAssign{ConversationID: fmt.Sprintf("conversation-%d", i), Account: "account1"}
+				arm, ok := system.ExperimentArmOf(conversation)
+				assert.True(t, ok)
+				if arm == ArmTreatment {
+					treatment++
+				}
+
+				again, _ := system.ExperimentArmOf(conversation)
+				assert.Equal(t, arm, again)
+			}
+
+			assert.GreaterOrEqual(t, treatment, test.minTreatment)
+			assert.LessOrEqual(t, treatment, test.maxTreatment)
+		})
+	}
+}
+
+func TestExperimentSplitByCustomer(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1}})
+	assert.NoError(t, system.SetExperiment("account1", Experiment{Name: "by-customer", TreatmentPercent: 50, ByCustomer: true}))
+
+	// Every conversation of a customer lands on the same arm
+	for customer := range 20 {
+		customerID := fmt.Sprintf("customer-%d", customer)
+		first, _ := system.ExperimentArmOf(ConversationToAssign{ConversationID: "first", Account: "account1", CustomerID: customerID})
+		for i := range 10 {
+			arm, _ := system.ExperimentArmOf(ConversationToAssign{ConversationID: fmt.Sprintf("conversation-%d", i), Account: "account1", CustomerID: customerID})
+			assert.Equal(t, first, arm)
+		}
+	}
+
+	// Without a customer the conversation ID decides
+	arms := make(map[ExperimentArm]bool)
+	for i := range 20 {
+		arm, _ := system.ExperimentArmOf(ConversationToAssign{ConversationID: fmt.Sprintf("conversation-%d", i), Account: "account1"})
+		arms[arm] = true
+	}
+	assert.Len(t, arms, 2)
+}
+
+func TestSetExperimentValidation(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1}})
+
+	assert.Error(t, system.SetExperiment("account1", Experiment{TreatmentPercent: -1}))
+	assert.Error(t, system.SetExperiment("account1", Experiment{TreatmentPercent: 100.5}))
+	_, ok := system.ExperimentResults("account1")
+	assert.False(t, ok)
+}
+
+func TestIntegrationExperiment(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+		{Name: "agent2", Account: "account1", Limit: 1},
+		{Name: "agent3", Account: "account2", Limit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetOverflowChain("account1", []OverflowTier{{}}) // Wait for any agent
+	system.SetSelectionMode("account1", SelectLowestOccupancy)
+
+	assert.NoError(t, system.SetExperiment("account1", Experiment{
+		Name:             "idle",
+		Control:          SelectLeastRecentAssignment,
+		Treatment:        SelectLongestIdle,
+		TreatmentPercent: 50,
+	}))
+	assert.NoError(t, system.SetExperiment("account2", Experiment{Name: "everyone", TreatmentPercent: 100}))
+
+	control := conversationsOnArm(&system, "account1", ArmControl, 2)
+	treatment := conversationsOnArm(&system, "account1", ArmTreatment, 1)
+
+	// Each arm's mode replaces the account's own
+	assert.Equal(t, SelectLeastRecentAssignment, system.selectionMode(control[0]))
+	assert.Equal(t, SelectLongestIdle, system.selectionMode(treatment[0]))
+
+	_, err := system.Assign([]ConversationToAssign{control[0], treatment[0]})
+	assert.NoError(t, err)
+	_, err = system.Assign([]ConversationToAssign{control[1]}) // Nobody is free, it waits
+	assert.NoError(t, err)
+
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, system.Complete(control[0].ConversationID))
+	assert.Equal(t, map[string]string{control[1].ConversationID: "agent1"}, system.ReevaluateWaiting())
+
+	// account2 has a single agent, the second conversation fails
+	_, err = system.Assign([]ConversationToAssign{
+		{ConversationID: "c1", Account: "account2"},
+		{ConversationID: "c2", Account: "account2"},
+	})
+	assert.ErrorIs(t, err.(*BatchAssignmentError).Failures[0], ErrNoAvailableAgents)
+
+	results, ok := system.ExperimentResults("account1")
+	assert.True(t, ok)
+	assert.Equal(t, ArmResults{
+		Arm:           ArmControl,
+		Mode:          SelectLeastRecentAssignment,
+		Conversations: 2,
+		Assigned:      2,
+		MeanWait:      15 * time.Second,
+		MaxWait:       30 * time.Second,
+		Gini:          0.5, // agent1 got both
+	}, results.Control)
+	assert.Equal(t, ArmResults{
+		Arm:           ArmTreatment,
+		Mode:          SelectLongestIdle,
+		Conversations: 1,
+		Assigned:      1,
+		Gini:          0.5,
+	}, results.Treatment)
+
+	all := system.ExperimentResultsByAccount()
+	assert.Len(t, all, 2)
+	assert.Equal(t, "account2", all[1].Account)
+	assert.Equal(t, 2, all[1].Treatment.Conversations)
+	assert.Equal(t, 1, all[1].Treatment.Failed)
+	assert.InDelta(t, 0.5, all[1].Treatment.FailureRate, 1e-9)
+	assert.Zero(t, all[1].Control.Conversations)
+
+	// Exported as one JSON line per account
+	var buffer bytes.Buffer
+	assert.NoError(t, system.WriteExperimentResults(&buffer))
+	decoder := json.NewDecoder(&buffer)
+	for _, expected := range all {
+		var exported ExperimentResults
+		assert.NoError(t, decoder.Decode(&exported))
+		assert.Equal(t, expected, exported)
+	}
+	assert.False(t, decoder.More())
+
+	// Clearing goes back to the account's own mode
+	system.ClearExperiment("account1")
+	_, ok = system.ExperimentResults("account1")
+	assert.False(t, ok)
+	assert.Equal(t, SelectLowestOccupancy, system.selectionMode(control[0]))
+}
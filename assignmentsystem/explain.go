@@ -0,0 +1,254 @@
+package assignmentsystem
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// CandidateExplanation is where one of the account's agents stands for a
+// conversation
+type CandidateExplanation struct {
+	ComparedAgent
+	Team string `json:"team,omitempty"`
+
+	// Position among the agents that could take the conversation, 1 being the
+	// one it would go to. Zero for excluded agents.
+	Rank     int             `json:"rank"`
+	Excluded ExclusionReason `json:"excluded,omitempty"`
+	Reason   string          `json:"reason"`
+}
+
+// Explanation is how a conversation would be assigned right now
+type Explanation struct {
+	ConversationID string        `json:"conversation_id"`
+	Account        string        `json:"account"`
+	At             time.Time     `json:"at"`
+	Waited         time.Duration `json:"waited_ns"`
+
+	AgentName string            `json:"agent_name,omitempty"` // Empty if nobody could take it
+	Criterion DecisionCriterion `json:"criterion,omitempty"`
+	// The agents that could take it in the order they would be picked,
+	// followed by the excluded ones in roster order
+	Candidates []CandidateExplanation `json:"candidates"`
+}
+
+// Explain runs a conversation through the same selection as Assign without
+// assigning it or recording anything, and returns every agent of its account
+// ranked with the reason it was excluded or ranked below the one before it. A
+// conversation that is already waiting is explained with the time it has
+// waited so far. The error is the one Assign would fail with, if any.
+//
+// The explanation is for the conversation on its own. Conversations already
+// waiting for the account are retried before a new one is placed, and may
+// take the agent first. With batch matching on, it holds when the conversation
+// is the only one of its account in the batch, larger shares are placed by
+// solving the matching for all of them at once.
+func (as *AssignmentSystem) Explain(conversation ConversationToAssign) (Explanation, error) {
+	now := as.clock()
+	waited := as.waitedSoFar(conversation, now)
+	explanation := Explanation{
+		ConversationID: conversation.ConversationID,
+		Account:        conversation.Account,
+		At:             now,
+		Waited:         waited,
+		Candidates:     make([]CandidateExplanation, 0, len(as.accountAgents[conversation.Account])),
+	}
+
+	if !as.isOpen(conversation.Account, now) {
+		for _, agentName := range as.accountAgents[conversation.Account] {
+			explanation.Candidates = append(explanation.Candidates, CandidateExplanation{
+				ComparedAgent: ComparedAgent{AgentName: agentName, Conversations: len(as.agentAssignments[agentName].Queue)},
+				Team:          as.agentAssignments[agentName].Team,
+				Reason:        "the account is closed",
+			})
+		}
+		return explanation, ErrOutsideBusinessHours
+	}
+
+	eligible := make([]*AgentWorkQueue, 0)
+	excluded := make([]CandidateExplanation, 0)
+	teams := as.eligibleTeams(conversation.Account, waited)
+	for _, agentName := range as.accountAgents[conversation.Account] {
+		wq := as.agentAssignments[agentName]
+		reason := wq.exclusion(conversation.Account, now)
+		if reason == "" && teams != nil && !slices.Contains(teams, wq.Team) {
+			reason = ExcludedWrongTeam
+		}
+
+		if reason == "" {
+			eligible = append(eligible, wq)
+			continue
+		}
+		excluded = append(excluded, CandidateExplanation{
+			ComparedAgent: ComparedAgent{AgentName: agentName, Conversations: len(wq.Queue)},
+			Team:          wq.Team,
+			Excluded:      reason,
+			Reason:        exclusionDetail(wq, conversation.Account, reason, now),
+		})
+	}
+
+	if len(eligible) == 0 {
+		explanation.Candidates = append(explanation.Candidates, excluded...)
+		return explanation, ErrNoAvailableAgents
+	}
+
+	leastLoaded := getWorkqueuesWithLeastAmountOfWork(eligible, now)
+	mode := as.selectionMode(conversation)
+	chosen := as.selectWorkQueue(mode, leastLoaded)
+
+	explanation.AgentName = chosen.AgentName
+	explanation.Criterion = CriterionLeastLoad
+	if len(leastLoaded) > 1 {
+		explanation.Criterion = criterionOf(mode)
+	}
+
+	// The chosen agent first, then the rest as they would be picked if it
+	// weren't there, by load and then by the selection mode
+	criterion := criterionOf(mode)
+	ranked := slices.DeleteFunc(slices.Clone(eligible), func(wq *AgentWorkQueue) bool { return wq == chosen })
+	slices.SortStableFunc(ranked, func(a, b *AgentWorkQueue) int {
+		if byLoad := cmp.Compare(a.load(now), b.load(now)); byLoad != 0 {
+			return byLoad
+		}
+		return compareByCriterion(criterion, a, b, now)
+	})
+	ranked = slices.Insert(ranked, 0, chosen)
+
+	for i, wq := range ranked {
+		candidate := CandidateExplanation{
+			ComparedAgent: comparedAgent(criterion, wq, now),
+			Team:          wq.Team,
+			Rank:          i + 1,
+		}
+		if i == 0 {
+			candidate.Reason = winnerDetail(explanation.Criterion, wq, now)
+		} else {
+			candidate.Reason = rankDetail(criterion, ranked[i-1], wq, now)
+		}
+		explanation.Candidates = append(explanation.Candidates, candidate)
+	}
+	explanation.Candidates = append(explanation.Candidates, excluded...)
+
+	return explanation, nil
+}
+
+// waitedSoFar is how long the conversation has been waiting, zero if it
+// isn't or its wait hasn't started because the account is closed
+func (as *AssignmentSystem) waitedSoFar(conversation ConversationToAssign, now time.Time) time.Duration {
+	for _, waiting := range as.waitingConversations[conversation.Account] {
+		if waiting.ConversationID == conversation.ConversationID && !waiting.AfterHours {
+			return now.Sub(waiting.WaitingSince)
+		}
+	}
+	return 0
+}
+
+// compareByCriterion orders two equally loaded agents the way the criterion
+// would pick between them
+func compareByCriterion(criterion DecisionCriterion, a, b *AgentWorkQueue, now time.Time) int {
+	switch criterion {
+	case CriterionLongestIdle:
+		return compareAssignmentTimes(a.LastCompletionTime, b.LastCompletionTime)
+	case CriterionLowestOccupancy:
+		return cmp.Compare(a.occupancy(now), b.occupancy(now))
+	}
+	return compareAssignmentTimes(a.LastAssignmentTime, b.LastAssignmentTime)
+}
+
+// compareAssignmentTimes orders never assigned first, then oldest first
+func compareAssignmentTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	default:
+		return a.Compare(*b)
+	}
+}
+
+func exclusionDetail(wq *AgentWorkQueue, account string, reason ExclusionReason, now time.Time) string {
+	switch reason {
+	case ExcludedUnavailable:
+		return fmt.Sprintf("%s, not online", statusName(wq.Status))
+	case ExcludedAtLimit:
+		if held := wq.slotsInWrapUp(now); held > 0 {
+			return fmt.Sprintf("at its limit of %d with %d conversations and %d slots held for wrap-up", wq.Limit, len(wq.Queue), held)
+		}
+		return fmt.Sprintf("at its limit of %d with %d conversations", wq.Limit, len(wq.Queue))
+	case ExcludedAtAccountLimit:
+		return fmt.Sprintf("at its limit of %d for %s", wq.AccountLimits[account], account)
+	case ExcludedWrongTeam:
+		return fmt.Sprintf("team %q isn't eligible yet", wq.Team)
+	}
+	return string(reason)
+}
+
+func winnerDetail(criterion DecisionCriterion, wq *AgentWorkQueue, now time.Time) string {
+	if held := wq.slotsInWrapUp(now); held > 0 {
+		if criterion == CriterionLeastLoad {
+			return fmt.Sprintf("the only agent with as little work as %s", loadDetail(wq, now))
+		}
+		return fmt.Sprintf("least work (%s), tie broken by %s", loadDetail(wq, now), criterion)
+	}
+
+	if criterion == CriterionLeastLoad {
+		return fmt.Sprintf("the only agent with as few as %d conversations", len(wq.Queue))
+	}
+	return fmt.Sprintf("fewest conversations (%d), tie broken by %s", len(wq.Queue), criterion)
+}
+
+// rankDetail says why an agent ranks below the one before it
+func rankDetail(criterion DecisionCriterion, ahead, wq *AgentWorkQueue, now time.Time) string {
+	if wq.load(now) > ahead.load(now) {
+		if wq.slotsInWrapUp(now) > 0 || ahead.slotsInWrapUp(now) > 0 {
+			return fmt.Sprintf("more work than %s (%s against %s)", ahead.AgentName, loadDetail(wq, now), loadDetail(ahead, now))
+		}
+		return fmt.Sprintf("more conversations than %s (%d against %d)", ahead.AgentName, len(wq.Queue), len(ahead.Queue))
+	}
+	if compareByCriterion(criterion, ahead, wq, now) == 0 {
+		return fmt.Sprintf("tied with %s on %s, which comes first in the roster", ahead.AgentName, criterion)
+	}
+
+	switch criterion {
+	case CriterionLongestIdle:
+		return fmt.Sprintf("idle for less long than %s (last completion %s against %s)",
+			ahead.AgentName, formatTime(wq.LastCompletionTime), formatTime(ahead.LastCompletionTime))
+	case CriterionLowestOccupancy:
+		return fmt.Sprintf("busier than %s in the last hour (%.0f%% against %.0f%%)",
+			ahead.AgentName, 100*wq.occupancy(now), 100*ahead.occupancy(now))
+	}
+	return fmt.Sprintf("assigned to more recently than %s (last assignment %s against %s)",
+		ahead.AgentName, formatTime(wq.LastAssignmentTime), formatTime(ahead.LastAssignmentTime))
+}
+
+// loadDetail spells out an agent's load, slots held for wrap-up included
+func loadDetail(wq *AgentWorkQueue, now time.Time) string {
+	if held := wq.slotsInWrapUp(now); held > 0 {
+		return fmt.Sprintf("%d conversations and %d slots held for wrap-up", len(wq.Queue), held)
+	}
+	return fmt.Sprintf("%d conversations", len(wq.Queue))
+}
+
+func statusName(status AgentStatus) string {
+	switch status {
+	case AgentAway:
+		return "away"
+	case AgentClosing:
+		return "closing"
+	case AgentOffline:
+		return "offline"
+	}
+	return "online"
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,185 @@
+package assignmentsystem
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrationExplain(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2, Team: "tier1"},
+		{Name: "agent2", Account: "account1", Limit: 1, Team: "tier1"},
+		{Name: "agent3", Account: "account1", Limit: 2, Team: "tier2"},
+		{Name: "agent4", Account: "account1", Limit: 2, Team: "tier1"},
+		{Name: "agent5", Account: "account1", Limit: 2, Team: "tier1"},
+		{Name: "agent6", Account: "account1", Limit: 2, Team: "tier1"},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetOverflowChain("account1", []OverflowTier{{Teams: []string{"tier1"}}, {After: time.Minute}})
+
+	// agent2 fills up, agent4 keeps one conversation, agent5 was last
+	// assigned to before agent6
+	for _, id := range []string{"c1", "c2", "c3", "c4"} {
+		_, err := system.Assign([]ConversationToAssign{{ConversationID: id, Account: "account1"}})
+		assert.NoError(t, err)
+		now = now.Add(time.Minute)
+	}
+	assert.NoError(t, system.Complete("c1"))
+	assert.NoError(t, system.Complete("c4"))
+	assert.NoError(t, system.SetStatus("agent1", AgentAway))
+	_, err := system.Assign([]ConversationToAssign{{ConversationID: "c5", Account: "account1"}})
+	assert.NoError(t, err)
+	assert.NoError(t, system.Complete("c5"))
+
+	var before bytes.Buffer
+	assert.NoError(t, system.WriteSnapshot(&before))
+
+	explanation, err := system.Explain(ConversationToAssign{ConversationID: "next", Account: "account1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "agent5", explanation.AgentName)
+	assert.Equal(t, CriterionLeastRecentAssignment, explanation.Criterion)
+
+	type ranking struct {
+		AgentName string
+		Rank      int
+		Excluded  ExclusionReason
+	}
+	rankings := make([]ranking, 0)
+	for _, candidate := range explanation.Candidates {
+		rankings = append(rankings, ranking{candidate.AgentName, candidate.Rank, candidate.Excluded})
+	}
+	assert.Equal(t, []ranking{
+		{"agent5", 1, ""},
+		{"agent6", 2, ""},
+		{"agent4", 3, ""},
+		{"agent1", 0, ExcludedUnavailable},
+		{"agent2", 0, ExcludedAtLimit},
+		{"agent3", 0, ExcludedWrongTeam},
+	}, rankings)
+	assert.Equal(t, "fewest conversations (0), tie broken by least_recent_assignment", explanation.Candidates[0].Reason)
+	assert.Equal(t, "assigned to more recently than agent5 (last assignment 2025-01-06T09:04:00Z against 2025-01-06T09:03:00Z)", explanation.Candidates[1].Reason)
+	assert.Equal(t, "more conversations than agent6 (1 against 0)", explanation.Candidates[2].Reason)
+	assert.Equal(t, "away, not online", explanation.Candidates[3].Reason)
+	assert.Equal(t, "at its limit of 1 with 1 conversations", explanation.Candidates[4].Reason)
+
+	// Nothing changed, and assigning does what was explained
+	var after bytes.Buffer
+	assert.NoError(t, system.WriteSnapshot(&after))
+	assert.Equal(t, before.String(), after.String())
+
+	assignedAgents, err := system.Assign([]ConversationToAssign{{ConversationID: "next", Account: "account1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{explanation.AgentName}, assignedAgents)
+}
+
+func TestExplainFailures(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1, Team: "tier1"},
+		{Name: "agent2", Account: "account1", Limit: 1, Team: "tier2"},
+		{Name: "agent3", Account: "account2", Limit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetOverflowChain("account1", []OverflowTier{{Teams: []string{"tier1"}}, {After: time.Minute}})
+	system.SetBusinessHours("account2", BusinessHours{Holidays: []time.Time{now}})
+
+	_, err := system.Explain(ConversationToAssign{ConversationID: "closed", Account: "account2"})
+	assert.ErrorIs(t, err, ErrOutsideBusinessHours)
+
+	_, err = system.Assign([]ConversationToAssign{
+		{ConversationID: "c1", Account: "account1"},
+		{ConversationID: "c2", Account: "account1"}, // Waits for tier2
+	})
+	assert.NoError(t, err)
+
+	explanation, err := system.Explain(ConversationToAssign{ConversationID: "c2", Account: "account1"})
+	assert.ErrorIs(t, err, ErrNoAvailableAgents)
+	assert.Empty(t, explanation.AgentName)
+	assert.Equal(t, ExcludedAtLimit, explanation.Candidates[0].Excluded)
+	assert.Equal(t, ExcludedWrongTeam, explanation.Candidates[1].Excluded)
+
+	// Once it has waited long enough tier2 can take it
+	now = now.Add(time.Minute)
+	explanation, err = system.Explain(ConversationToAssign{ConversationID: "c2", Account: "account1"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, explanation.Waited)
+	assert.Equal(t, "agent2", explanation.AgentName)
+	assert.Equal(t, CriterionLeastLoad, explanation.Criterion)
+}
+
+// Explain has to pick whoever Assign then picks, whatever state the system is
+// in and whether batch matching is on
+func TestExplainAgreesWithAssign(t *testing.T) {
+	for _, matchingLimit := range []int{0, 10} {
+		for _, mode := range []SelectionMode{SelectLeastRecentAssignment, SelectLongestIdle, SelectLowestOccupancy} {
+			t.Run(fmt.Sprintf("%d/matching %d", mode, matchingLimit), func(t *testing.T) {
+				random := rand.New(rand.NewSource(int64(mode) + 1))
+				now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+				agents := make([]AgentNameAndAccount, 0)
+				for i := range 12 {
+					agents = append(agents, AgentNameAndAccount{Name: fmt.Sprintf("agent%d", i), Account: "account1", Limit: 1 + random.Intn(3)})
+				}
+				system := NewAssignmentSystem(agents)
+				system.SetClock(func() time.Time { return now })
+				system.SetSelectionMode("account1", mode)
+				system.SetBatchMatching(matchingLimit)
+
+				active := make([]string, 0)
+				for i := range 500 {
+					now = now.Add(time.Duration(random.Intn(60)) * time.Second)
+					if len(active) > 0 && random.Intn(2) == 0 {
+						k := random.Intn(len(active))
+						assert.NoError(t, system.Complete(active[k]))
+						active = append(active[:k], active[k+1:]...)
+						continue
+					}
+
+					conversation := ConversationToAssign{ConversationID: fmt.Sprintf("c%d", i), Account: "account1"}
+					explanation, explainErr := system.Explain(conversation)
+					assignedAgents, err := system.Assign([]ConversationToAssign{conversation})
+					if explainErr != nil {
+						assert.Error(t, err)
+						continue
+					}
+					assert.NoError(t, err)
+					assert.Equal(t, []string{explanation.AgentName}, assignedAgents)
+					active = append(active, conversation.ConversationID)
+				}
+			})
+		}
+	}
+}
+
+// A matched batch goes to the agents Explain ranks first, cheapest first
+func TestExplainBatchMatching(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+		{Name: "agent2", Account: "account1", Limit: 2},
+		{Name: "agent3", Account: "account1", Limit: 2},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetBatchMatching(10)
+	_, err := system.Assign([]ConversationToAssign{{ConversationID: "c1", Account: "account1"}})
+	assert.NoError(t, err)
+
+	batch := []ConversationToAssign{
+		{ConversationID: "c2", Account: "account1"},
+		{ConversationID: "c3", Account: "account1"},
+	}
+	explanation, err := system.Explain(batch[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "agent2", explanation.AgentName)
+	assert.Equal(t, CriterionLeastRecentAssignment, explanation.Criterion)
+
+	assignedAgents, err := system.Assign(batch)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent2", "agent3"}, assignedAgents)
+}
@@ -0,0 +1,195 @@
+package assignmentsystem
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+// AgentFairness is how much work one agent was given since fairness tracking
+// started
+type AgentFairness struct {
+	AgentName          string        `json:"agent_name"`
+	Limit              int           `json:"limit"`
+	Assignments        int           `json:"assignments"`
+	AssignmentsPerHour float64       `json:"assignments_per_hour"`
+	IdleTime           time.Duration `json:"idle_time_ns"`
+}
+
+// IdleSpread describes how the time agents spent without a conversation
+// varies between them
+type IdleSpread struct {
+	Min    time.Duration `json:"min_ns"`
+	Max    time.Duration `json:"max_ns"`
+	Mean   time.Duration `json:"mean_ns"`
+	StdDev time.Duration `json:"stddev_ns"`
+}
+
+// FairnessReport describes how evenly an account's conversations were spread
+// across its agents since fairness tracking started. Agents shared with other
+// accounts count everything they were given. Agents with a zero Limit can't be
+// given anything and are left out.
+type FairnessReport struct {
+	Account     string        `json:"account"`
+	Since       time.Time     `json:"since"`
+	Period      time.Duration `json:"period_ns"`
+	Agents      int           `json:"agents"`
+	Assignments int           `json:"assignments"`
+
+	// Gini coefficient of assignments per unit of Limit, 0 when every agent
+	// got work in proportion to its limit and approaching 1 when one agent got
+	// all of it
+	Gini float64 `json:"gini"`
+	// Most over fewest assignments per unit of Limit, zero if an agent got
+	// nothing
+	MaxMinRatio             float64    `json:"max_min_ratio"`
+	AssignmentsPerAgentHour float64    `json:"assignments_per_agent_hour"`
+	Idle                    IdleSpread `json:"idle"`
+
+	AgentDetails []AgentFairness `json:"agent_details,omitempty"` // Only filled in by Fairness
+}
+
+// ResetFairness clears the assignment counts and idle times fairness is
+// measured from and starts measuring again from now. Tracking otherwise starts
+// with the first assignment.
+func (as *AssignmentSystem) ResetFairness() {
+	as.fairnessSince = as.clock()
+	for _, wq := range as.agentAssignments {
+		wq.Assignments = 0
+		wq.IdleTime = 0
+	}
+}
+
+// startFairness starts fairness tracking if nothing has been assigned yet
+func (as *AssignmentSystem) startFairness() {
+	if as.fairnessSince.IsZero() {
+		as.fairnessSince = as.clock()
+	}
+}
+
+// Fairness reports how evenly the account's conversations were spread across
+// its agents, including the figures for every agent
+func (as *AssignmentSystem) Fairness(account string) FairnessReport {
+	report, agents := as.fairness(account, as.clock())
+	report.AgentDetails = agents
+	return report
+}
+
+// FairnessByAccount reports on every account in name order, without the per
+// agent figures
+func (as *AssignmentSystem) FairnessByAccount() []FairnessReport {
+	now := as.clock()
+	reports := make([]FairnessReport, 0, len(as.accountAgents))
+
+	for _, account := range slices.Sorted(maps.Keys(as.accountAgents)) {
+		report, _ := as.fairness(account, now)
+		reports = append(reports, report)
+	}
+
+	return reports
+}
+
+func (as *AssignmentSystem) fairness(account string, now time.Time) (FairnessReport, []AgentFairness) {
+	report := FairnessReport{Account: account, Since: as.fairnessSince}
+	if !as.fairnessSince.IsZero() && now.After(as.fairnessSince) {
+		report.Period = now.Sub(as.fairnessSince)
+	}
+
+	agents := make([]AgentFairness, 0, len(as.accountAgents[account]))
+	perLimit := make([]float64, 0, len(as.accountAgents[account]))
+	idleTimes := make([]time.Duration, 0, len(as.accountAgents[account]))
+
+	for _, agentName := range as.accountAgents[account] {
+		wq := as.agentAssignments[agentName]
+		if wq.Limit <= 0 {
+			continue
+		}
+
+		agent := AgentFairness{
+			AgentName:   agentName,
+			Limit:       wq.Limit,
+			Assignments: wq.Assignments,
+			IdleTime:    wq.IdleTime + wq.currentIdle(as.fairnessSince, now),
+		}
+		if report.Period > 0 {
+			agent.AssignmentsPerHour = float64(agent.Assignments) / report.Period.Hours()
+		}
+
+		agents = append(agents, agent)
+		perLimit = append(perLimit, float64(wq.Assignments)/float64(wq.Limit))
+		idleTimes = append(idleTimes, agent.IdleTime)
+		report.Assignments += wq.Assignments
+	}
+
+	report.Agents = len(agents)
+	if report.Agents == 0 {
+		return report, agents
+	}
+
+	report.Gini = gini(perLimit)
+	lowest, highest := slices.Min(perLimit), slices.Max(perLimit)
+	if lowest > 0 {
+		report.MaxMinRatio = highest / lowest
+	}
+	if report.Period > 0 {
+		report.AssignmentsPerAgentHour = float64(report.Assignments) / float64(report.Agents) / report.Period.Hours()
+	}
+	report.Idle = spreadOfIdleTimes(idleTimes)
+
+	return report, agents
+}
+
+// currentIdle is how long the agent has been without a conversation, counted
+// from when fairness tracking started at the earliest
+func (wq *AgentWorkQueue) currentIdle(since, now time.Time) time.Duration {
+	if since.IsZero() || len(wq.Queue) > 0 {
+		return 0
+	}
+
+	idleSince := since
+	if wq.LastCompletionTime != nil && wq.LastCompletionTime.After(idleSince) {
+		idleSince = *wq.LastCompletionTime
+	}
+	if !now.After(idleSince) {
+		return 0
+	}
+
+	return now.Sub(idleSince)
+}
+
+// gini returns the Gini coefficient of the values, sorting them in place
+func gini(values []float64) float64 {
+	slices.Sort(values)
+
+	var total, weighted float64
+	for i, value := range values {
+		total += value
+		weighted += float64(i+1) * value
+	}
+	if total == 0 {
+		return 0
+	}
+
+	n := float64(len(values))
+	return 2*weighted/(n*total) - (n+1)/n
+}
+
+func spreadOfIdleTimes(idleTimes []time.Duration) IdleSpread {
+	spread := IdleSpread{Min: slices.Min(idleTimes), Max: slices.Max(idleTimes)}
+
+	var total float64
+	for _, idle := range idleTimes {
+		total += float64(idle)
+	}
+	mean := total / float64(len(idleTimes))
+
+	var variance float64
+	for _, idle := range idleTimes {
+		variance += (float64(idle) - mean) * (float64(idle) - mean)
+	}
+
+	spread.Mean = time.Duration(mean)
+	spread.StdDev = time.Duration(math.Sqrt(variance / float64(len(idleTimes))))
+	return spread
+}
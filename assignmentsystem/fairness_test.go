@@ -0,0 +1,115 @@
+package assignmentsystem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGini(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []float64
+		expectation float64
+	}{
+		{
+			name:        "Nothing assigned",
+			input:       []float64{0, 0, 0},
+			expectation: 0,
+		},
+		{
+			name:        "Perfectly even",
+			input:       []float64{2, 2, 2, 2},
+			expectation: 0,
+		},
+		{
+			name:        "One agent got everything",
+			input:       []float64{0, 1, 0, 0},
+			expectation: 0.75,
+		},
+		{
+			name:        "Uneven",
+			input:       []float64{2, 0.5},
+			expectation: 0.3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.InDelta(t, test.expectation, gini(test.input), 1e-9)
+		})
+	}
+}
+
+func TestIntegrationFairness(t *testing.T) {
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	now := start
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+		{Name: "agent2", Account: "account1", Limit: 2},
+		{Name: "agent3", Account: "account1", Limit: 0},
+		{Name: "agent4", Account: "account2", Limit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+
+	// Nothing is tracked before the first assignment
+	assert.Equal(t, FairnessReport{Account: "account1", Agents: 2, AgentDetails: []AgentFairness{
+		{AgentName: "agent1", Limit: 1},
+		{AgentName: "agent2", Limit: 2},
+	}}, system.Fairness("account1"))
+
+	assign := func(conversationID string) {
+		_, err := system.Assign([]ConversationToAssign{{ConversationID: conversationID, Account: "account1"}})
+		assert.NoError(t, err)
+	}
+
+	assign("conv1") // agent1
+	now = start.Add(10 * time.Minute)
+	assign("conv2") // agent2, idle for 10 minutes
+	now = start.Add(20 * time.Minute)
+	assert.NoError(t, system.Complete("conv1"))
+	now = start.Add(30 * time.Minute)
+	assign("conv3") // agent1 again, idle for 10 minutes
+	now = start.Add(50 * time.Minute)
+	assert.NoError(t, system.Complete("conv2"))
+	now = start.Add(60 * time.Minute)
+
+	report := system.Fairness("account1")
+
+	assert.Equal(t, start, report.Since)
+	assert.Equal(t, time.Hour, report.Period)
+	assert.Equal(t, 2, report.Agents)
+	assert.Equal(t, 3, report.Assignments)
+	// agent1 got 2 per unit of limit and agent2 0.5
+	assert.InDelta(t, 0.3, report.Gini, 1e-9)
+	assert.InDelta(t, 4, report.MaxMinRatio, 1e-9)
+	assert.InDelta(t, 1.5, report.AssignmentsPerAgentHour, 1e-9)
+	// agent2 has been idle since conv2 ended
+	assert.Equal(t, IdleSpread{Min: 10 * time.Minute, Max: 20 * time.Minute, Mean: 15 * time.Minute, StdDev: 5 * time.Minute}, report.Idle)
+	assert.Equal(t, []AgentFairness{
+		{AgentName: "agent1", Limit: 1, Assignments: 2, AssignmentsPerHour: 2, IdleTime: 10 * time.Minute},
+		{AgentName: "agent2", Limit: 2, Assignments: 1, AssignmentsPerHour: 1, IdleTime: 20 * time.Minute},
+	}, report.AgentDetails)
+
+	byAccount := system.FairnessByAccount()
+	assert.Len(t, byAccount, 2)
+	assert.Nil(t, byAccount[0].AgentDetails)
+	assert.Equal(t, report.Gini, byAccount[0].Gini)
+	// agent4 was never given anything and has been idle all along
+	assert.Equal(t, "account2", byAccount[1].Account)
+	assert.Equal(t, 0.0, byAccount[1].MaxMinRatio)
+	assert.Equal(t, time.Hour, byAccount[1].Idle.Max)
+
+	system.ResetFairness()
+	now = start.Add(90 * time.Minute)
+	report = system.Fairness("account1")
+
+	assert.Equal(t, 30*time.Minute, report.Period)
+	assert.Equal(t, 0, report.Assignments)
+	assert.Equal(t, []AgentFairness{
+		{AgentName: "agent1", Limit: 1},
+		{AgentName: "agent2", Limit: 2, IdleTime: 30 * time.Minute},
+	}, report.AgentDetails)
+}
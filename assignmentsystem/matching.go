@@ -0,0 +1,277 @@
+package assignmentsystem
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+// SetBatchMatching switches Assign to solving each account's share of a batch
+// as a min-cost assignment problem instead of handing conversations out one at
+// a time. Filling an agent's slot costs more the more work the agent would
+// then have, and among equally loaded agents the more the conversation's
+// selection mode ranks the agent down, so conversations of different
+// experiment arms get the agents their modes prefer between them. Accounts are
+// solved in name order and an account's conversations are taken by ID, so the
+// outcome doesn't depend on the order of the batch. Accounts with more than
+// maxConversations in a batch fall back to the greedy path to bound the cost of
+// the solver. Zero turns matching off.
+func (as *AssignmentSystem) SetBatchMatching(maxConversations int) {
+	as.batchMatchingLimit = maxConversations
+}
+
+// matchingSlot is one free slot of an agent
+type matchingSlot struct {
+	wq       *AgentWorkQueue
+	load     int // The agent's load once the slot is filled
+	position int // Of the agent in the roster, breaks the remaining ties
+}
+
+func (as *AssignmentSystem) assignMatched(ctx context.Context, conversations []ConversationToAssign, indexes []int, outcomes []assignmentOutcome) {
+	byAccount := make(map[string][]int)
+	for _, i := range indexes {
+		byAccount[conversations[i].Account] = append(byAccount[conversations[i].Account], i)
+	}
+
+	now := as.clock()
+	for _, account := range slices.Sorted(maps.Keys(byAccount)) {
+		accountIndexes := byAccount[account]
+		if ctx.Err() != nil {
+			for _, i := range accountIndexes {
+				outcomes[i] = notAttempted(ctx)
+			}
+			continue
+		}
+
+		// A single conversation is matched to whoever the greedy path picks
+		if len(accountIndexes) == 1 || len(accountIndexes) > as.batchMatchingLimit || !as.isOpen(account, now) {
+			for _, i := range accountIndexes {
+				outcomes[i] = as.assignOrWait(conversations[i])
+			}
+			continue
+		}
+
+		as.serveWaitingFirst(account)
+		slices.SortStableFunc(accountIndexes, func(a, b int) int {
+			return cmp.Compare(conversations[a].ConversationID, conversations[b].ConversationID)
+		})
+		as.matchAccount(account, conversations, accountIndexes, outcomes, now)
+	}
+}
+
+func (as *AssignmentSystem) matchAccount(account string, conversations []ConversationToAssign, indexes []int, outcomes []assignmentOutcome, now time.Time) {
+	eligibleWorkQueues := getEligibleAgentWorkQueues(as.accountAgents, as.agentAssignments, account, now)
+	eligibleWorkQueues = filterWorkQueuesByTeams(eligibleWorkQueues, as.eligibleTeams(account, 0))
+
+	modes := make([]SelectionMode, len(indexes))
+	for row, i := range indexes {
+		modes[row] = as.selectionMode(conversations[i])
+	}
+	slots, ranks := matchingSlots(eligibleWorkQueues, account, modes, len(indexes), now)
+
+	// Load always outweighs rank, and a conversation left without a slot
+	// costs more than any slot
+	rankWeight := int64(len(slots) + 1)
+	unmatched := int64(math.MaxInt32)
+	costs := make([][]int64, len(indexes))
+	for row := range indexes {
+		costs[row] = make([]int64, max(len(slots), len(indexes)))
+		for col := range costs[row] {
+			costs[row][col] = unmatched
+			if col < len(slots) {
+				costs[row][col] = int64(slots[col].load)*rankWeight + int64(ranks[modes[row]][col])
+			}
+		}
+	}
+	matching := minCostMatching(costs)
+
+	// Fill the slots lowest load first, so every agent is among the least
+	// loaded when it is given its conversation
+	rows := make([]int, len(indexes))
+	for row := range rows {
+		rows[row] = row
+	}
+	slices.SortStableFunc(rows, func(a, b int) int {
+		return cmp.Compare(costs[a][matching[a]], costs[b][matching[b]])
+	})
+
+	for _, row := range rows {
+		i := indexes[row]
+		if matching[row] >= len(slots) {
+			// The usual path decides between waiting and failing
+			outcomes[i] = as.assignOrWait(conversations[i])
+			continue
+		}
+
+		chosen := slots[matching[row]].wq
+		if _, ok := as.shadows[account]; ok || as.audit != nil {
+			leastLoaded := getWorkqueuesWithLeastAmountOfWork(slices.DeleteFunc(slices.Clone(eligibleWorkQueues), func(wq *AgentWorkQueue) bool {
+				return wq.exclusion(account, now) != ""
+			}), now)
+			as.compareShadow(account, leastLoaded, chosen)
+			as.auditDecision(conversations[i], 0, leastLoaded, chosen, nil)
+		}
+
+		agent, err := as.assignToWorkQueue(chosen, conversations[i])
+		outcomes[i] = assignmentOutcome{AgentName: agent, Err: err}
+		as.recordArrival(conversations[i], outcomes[i])
+	}
+}
+
+// matchingSlots lists the free slots worth considering for conversations of
+// the given selection modes, and each slot's rank under each of the modes.
+// Costs only depend on a conversation through its mode, so the cheapest slots
+// under each mode, as many as there are conversations, always contain an
+// optimal matching.
+func matchingSlots(eligibleWorkQueues []*AgentWorkQueue, account string, modes []SelectionMode, limit int, now time.Time) ([]matchingSlot, map[SelectionMode][]int) {
+	compareUnder := func(mode SelectionMode) func(a, b matchingSlot) int {
+		criterion := criterionOf(mode)
+		return func(a, b matchingSlot) int {
+			if byLoad := cmp.Compare(a.load, b.load); byLoad != 0 {
+				return byLoad
+			}
+			if byCriterion := compareByCriterion(criterion, a.wq, b.wq, now); byCriterion != 0 {
+				return byCriterion
+			}
+			return cmp.Compare(a.position, b.position)
+		}
+	}
+
+	distinctModes := slices.Compact(slices.Sorted(slices.Values(modes)))
+	slots := make([]matchingSlot, 0)
+	for _, mode := range distinctModes {
+		compare := compareUnder(mode)
+		cheapest := make([]matchingSlot, 0, limit)
+		for position, wq := range eligibleWorkQueues {
+			for k := range min(wq.room(account, now), limit) {
+				slot := matchingSlot{wq: wq, load: wq.load(now) + k, position: position}
+				if len(cheapest) == limit && compare(slot, cheapest[limit-1]) >= 0 {
+					break // The agent's later slots only cost more
+				}
+
+				at, _ := slices.BinarySearchFunc(cheapest, slot, compare)
+				cheapest = slices.Insert(cheapest, at, slot)
+				if len(cheapest) > limit {
+					cheapest = cheapest[:limit]
+				}
+			}
+		}
+
+		for _, slot := range cheapest {
+			if !slices.Contains(slots, slot) {
+				slots = append(slots, slot)
+			}
+		}
+	}
+
+	ranks := make(map[SelectionMode][]int, len(distinctModes))
+	for _, mode := range distinctModes {
+		compare := compareUnder(mode)
+		ranks[mode] = make([]int, len(slots))
+		for col, slot := range slots {
+			for _, other := range slots {
+				if compare(other, slot) < 0 {
+					ranks[mode][col]++
+				}
+			}
+		}
+	}
+
+	return slots, ranks
+}
+
+// room is how many more of the account's conversations the agent can take,
+// whatever its status
+func (wq *AgentWorkQueue) room(account string, now time.Time) int {
+	free := wq.Limit - wq.load(now)
+	if accountLimit, ok := wq.AccountLimits[account]; ok {
+		free = min(free, accountLimit-wq.AccountLoad[account])
+	}
+
+	return free
+}
+
+// minCostMatching solves the assignment problem for a cost matrix with no more
+// rows than columns using the Hungarian algorithm, returning the column each
+// row is matched to. Runs in O(rows² × columns).
+func minCostMatching(costs [][]int64) []int {
+	rows := len(costs)
+	if rows == 0 {
+		return []int{}
+	}
+	columns := len(costs[0])
+
+	const infinity = math.MaxInt64 / 4
+	// Potentials and matches are 1-indexed, column 0 is a sentinel
+	rowPotential := make([]int64, rows+1)
+	columnPotential := make([]int64, columns+1)
+	matchedRow := make([]int, columns+1)
+	previousColumn := make([]int, columns+1)
+
+	for row := 1; row <= rows; row++ {
+		matchedRow[0] = row
+		column := 0
+		minSlack := make([]int64, columns+1)
+		for j := range minSlack {
+			minSlack[j] = infinity
+		}
+		visited := make([]bool, columns+1)
+
+		// Grow an alternating tree until it reaches a free column
+		for {
+			visited[column] = true
+			currentRow := matchedRow[column]
+			delta := int64(infinity)
+			nextColumn := 0
+
+			for j := 1; j <= columns; j++ {
+				if visited[j] {
+					continue
+				}
+
+				slack := costs[currentRow-1][j-1] - rowPotential[currentRow] - columnPotential[j]
+				if slack < minSlack[j] {
+					minSlack[j] = slack
+					previousColumn[j] = column
+				}
+				if minSlack[j] < delta {
+					delta = minSlack[j]
+					nextColumn = j
+				}
+			}
+
+			for j := 0; j <= columns; j++ {
+				if visited[j] {
+					rowPotential[matchedRow[j]] += delta
+					columnPotential[j] -= delta
+				} else {
+					minSlack[j] -= delta
+				}
+			}
+
+			column = nextColumn
+			if matchedRow[column] == 0 {
+				break
+			}
+		}
+
+		// Flip the augmenting path
+		for column != 0 {
+			previous := previousColumn[column]
+			matchedRow[column] = matchedRow[previous]
+			column = previous
+		}
+	}
+
+	result := make([]int, rows)
+	for j := 1; j <= columns; j++ {
+		if matchedRow[j] != 0 {
+			result[matchedRow[j]-1] = j - 1
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,282 @@
+package assignmentsystem
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinCostMatching(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        [][]int64
+		expectedCost int64
+	}{
+		{
+			name:         "Empty input",
+			input:        [][]int64{},
+			expectedCost: 0,
+		},
+		{
+			name: "Greedy row by row is not optimal",
+			input: [][]int64{
+				{1, 2},
+				{1, 10},
+			},
+			expectedCost: 3,
+		},
+		{
+			name: "Square matrix",
+			input: [][]int64{
+				{4, 1, 3},
+				{2, 0, 5},
+				{3, 2, 2},
+			},
+			expectedCost: 5,
+		},
+		{
+			name: "More columns than rows",
+			input: [][]int64{
+				{7, 3, 9, 1},
+				{2, 8, 1, 6},
+			},
+			expectedCost: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := minCostMatching(test.input)
+			assert.Len(t, result, len(test.input))
+
+			var cost int64
+			used := make(map[int]bool)
+			for row, col := range result {
+				assert.False(t, used[col], "column %d matched twice", col)
+				used[col] = true
+				cost += test.input[row][col]
+			}
+			assert.Equal(t, test.expectedCost, cost)
+		})
+	}
+}
+
+func TestIntegrationBatchMatching(t *testing.T) {
+	initialData := []AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2},
+		{Name: "agent2", Account: "account1", Limit: 2},
+		{Name: "agent3", Account: "account2", Limit: 1},
+	}
+
+	system := NewAssignmentSystem(initialData)
+	system.SetBatchMatching(10)
+
+	conversations := []ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+		{ConversationID: "conv2", Account: "account2"},
+		{ConversationID: "conv3", Account: "account1"},
+		{ConversationID: "conv4", Account: "account1"},
+		{ConversationID: "conv5", Account: "account1"},
+		{ConversationID: "conv6", Account: "account1"}, // Should fail - account1 is full
+	}
+
+	assignedAgents, err := system.Assign(conversations)
+
+	assert.Error(t, err)
+	// Results stay in the order of the batch
+	assert.Len(t, assignedAgents, 5)
+	assert.Equal(t, "agent3", assignedAgents[1])
+	assert.Len(t, system.agentAssignments["agent1"].Queue, 2)
+	assert.Len(t, system.agentAssignments["agent2"].Queue, 2)
+	assert.Equal(t, "conv6", err.(*BatchAssignmentError).Failures[0].ConversationID)
+}
+
+func TestIntegrationBatchMatchingFallsBackAboveThreshold(t *testing.T) {
+	initialData := []AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 5, AccountLimit: 1},
+		{Name: "agent2", Account: "account1", Limit: 5},
+	}
+
+	system := NewAssignmentSystem(initialData)
+	system.SetBatchMatching(2)
+
+	conversations := make([]ConversationToAssign, 4)
+	for i := range conversations {
+		conversations[i] = ConversationToAssign{ConversationID: fmt.Sprintf("conv%d", i+1), Account: "account1"}
+	}
+
+	assignedAgents, err := system.Assign(conversations)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent1", "agent2", "agent2", "agent2"}, assignedAgents)
+}
+
+// Matching solves each account's share of the batch as a whole, so shuffling
+// the batch changes nothing, where the greedy path hands out agents in order
+func TestIntegrationBatchMatchingIgnoresBatchOrder(t *testing.T) {
+	random := rand.New(rand.NewSource(7))
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	agents := make([]AgentNameAndAccount, 0)
+	for i := range 8 {
+		agents = append(agents, AgentNameAndAccount{Name: fmt.Sprintf("agent%d", i), Account: "account1", Limit: 1 + random.Intn(3)})
+		agents = append(agents, AgentNameAndAccount{Name: fmt.Sprintf("other%d", i), Account: "account2", Limit: 1 + random.Intn(3)})
+	}
+	agents = append(agents,
+		AgentNameAndAccount{Name: "shared", Account: "account1", Limit: 4, AccountLimit: 2},
+		AgentNameAndAccount{Name: "shared", Account: "account2", AccountLimit: 3},
+	)
+
+	newSystem := func(matchingLimit int) *AssignmentSystem {
+		system := NewAssignmentSystem(agents)
+		system.SetClock(func() time.Time { return now })
+		system.SetBatchMatching(matchingLimit)
+		system.SetWrapUpDuration("account2", 10*time.Second)
+		system.SetSelectionMode("account1", SelectLongestIdle)
+		system.SetShadowSelectionMode("account1", SelectLowestOccupancy)
+		assert.NoError(t, system.SetExperiment("account2", Experiment{
+			Name:             "occupancy",
+			Control:          SelectLeastRecentAssignment,
+			Treatment:        SelectLowestOccupancy,
+			TreatmentPercent: 50,
+		}))
+		return &system
+	}
+	matched, shuffled := newSystem(20), newSystem(20)
+
+	active := make([]string, 0)
+	greedyDiffered := false
+	for i := range 300 {
+		now = now.Add(time.Duration(random.Intn(20)) * time.Second)
+		for range random.Intn(4) {
+			if len(active) == 0 {
+				break
+			}
+			k := random.Intn(len(active))
+			for _, system := range []*AssignmentSystem{matched, shuffled} {
+				assert.NoError(t, system.Complete(active[k]))
+			}
+			active = append(active[:k], active[k+1:]...)
+		}
+
+		batch := make([]ConversationToAssign, random.Intn(8))
+		for j := range batch {
+			batch[j] = ConversationToAssign{ConversationID: fmt.Sprintf("c%d-%d", i, j), Account: fmt.Sprintf("account%d", 1+random.Intn(2))}
+		}
+		reordered := slices.Clone(batch)
+		random.Shuffle(len(reordered), func(a, b int) { reordered[a], reordered[b] = reordered[b], reordered[a] })
+
+		expected := agentsByConversation(matched.AssignResults(context.Background(), batch))
+		assert.Equal(t, expected, agentsByConversation(shuffled.AssignResults(context.Background(), reordered)), "batch %d", i)
+		for id, agent := range expected {
+			if agent != "" {
+				active = append(active, id)
+			}
+		}
+
+		// Fresh greedy systems only see this batch, in either order
+		greedy, greedyShuffled := newSystem(0), newSystem(0)
+		if !maps.Equal(agentsByConversation(greedy.AssignResults(context.Background(), batch)), agentsByConversation(greedyShuffled.AssignResults(context.Background(), reordered))) {
+			greedyDiffered = true
+		}
+	}
+	assert.True(t, greedyDiffered)
+
+	expectedShadow, _ := matched.ShadowStats("account1")
+	shadow, _ := shuffled.ShadowStats("account1")
+	assert.Equal(t, expectedShadow, shadow)
+	assert.NotZero(t, shadow.TieBreaks)
+
+	expectedResults, _ := matched.ExperimentResults("account2")
+	results, _ := shuffled.ExperimentResults("account2")
+	assert.Equal(t, expectedResults, results)
+	assert.NotZero(t, results.Treatment.Assigned)
+}
+
+func agentsByConversation(results []AssignmentResult) map[string]string {
+	agents := make(map[string]string, len(results))
+	for _, result := range results {
+		agents[result.ConversationID] = result.AgentName
+	}
+	return agents
+}
+
+// benchmarkRoster mirrors the shape used by cmd/main.go on a smaller scale,
+// a few large accounts and many small ones
+func benchmarkRoster(random *rand.Rand) ([]AgentNameAndAccount, []string) {
+	agents := make([]AgentNameAndAccount, 0)
+	accounts := make([]string, 0)
+
+	addAccount := func(account string, size int) {
+		accounts = append(accounts, account)
+		for i := range size {
+			agents = append(agents, AgentNameAndAccount{
+				Name:    fmt.Sprintf("agent_%s_%d", account, i+1),
+				Account: account,
+				Limit:   random.Intn(16) + 5,
+			})
+		}
+	}
+
+	for i := range 5 {
+		addAccount(fmt.Sprintf("large_account_%d", i+1), 1000+random.Intn(4001))
+	}
+	for i := range 200 {
+		addAccount(fmt.Sprintf("small_account_%d", i+1), 10+random.Intn(91))
+	}
+
+	return agents, accounts
+}
+
+func benchmarkAssign(b *testing.B, matchingLimit int, parallelism int) {
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(output)
+
+	random := rand.New(rand.NewSource(1))
+	agents, accounts := benchmarkRoster(random)
+	system := NewAssignmentSystem(agents)
+	system.SetBatchMatching(matchingLimit)
+	system.SetParallelism(parallelism)
+
+	conversationNumber := 0
+	b.ResetTimer()
+	for range b.N {
+		// 100 conversations per batch as in cmd/main.go
+		b.StopTimer()
+		batch := make([]ConversationToAssign, 100)
+		for i := range batch {
+			conversationNumber++
+			batch[i] = ConversationToAssign{
+				ConversationID: fmt.Sprintf("conversation-%d", conversationNumber),
+				Account:        accounts[random.Intn(len(accounts))],
+			}
+		}
+		b.StartTimer()
+
+		system.Assign(batch)
+
+		// Free the capacity again so the roster never fills up
+		b.StopTimer()
+		for _, conversation := range batch {
+			system.Complete(conversation.ConversationID)
+		}
+		b.StartTimer()
+	}
+}
+
+func BenchmarkAssignGreedy(b *testing.B) {
+	benchmarkAssign(b, 0, 1)
+}
+
+func BenchmarkAssignBatchMatching(b *testing.B) {
+	benchmarkAssign(b, 100, 1)
+}
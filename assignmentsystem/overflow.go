@@ -0,0 +1,210 @@
+package assignmentsystem
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+)
+
+// OverflowTier is one step of an account's overflow chain. Once a conversation
+// has waited at least After, agents in Teams become eligible for it. An empty
+// Teams means any agent in the account.
+type OverflowTier struct {
+	Teams []string
+	After time.Duration
+}
+
+type waitingConversation struct {
+	ConversationToAssign
+	WaitingSince time.Time
+	AfterHours   bool // Queued while the account was closed, the wait starts when it opens
+}
+
+// SetOverflowChain configures the tiers used for an account, e.g.
+// Tier 1 → Tier 2 → any agent. Passing no tiers removes the chain and the
+// account goes back to rejecting conversations when nobody is available.
+func (as *AssignmentSystem) SetOverflowChain(account string, tiers []OverflowTier) {
+	if as.overflowChains == nil {
+		as.overflowChains = make(map[string][]OverflowTier)
+	}
+
+	if len(tiers) == 0 {
+		delete(as.overflowChains, account)
+		return
+	}
+
+	chain := slices.Clone(tiers)
+	slices.SortStableFunc(chain, func(a, b OverflowTier) int {
+		return cmp.Compare(a.After, b.After)
+	})
+	as.overflowChains[account] = chain
+}
+
+// ReevaluateWaiting retries the waiting conversations, account by account in
+// name order and oldest first within each, against every tier their wait time
+// now qualifies them for, so the same waiting list always ends up assigned
+// the same way. It returns the conversations that were assigned keyed by
+// conversation ID.
+func (as *AssignmentSystem) ReevaluateWaiting() map[string]string {
+	assigned, _ := as.ReevaluateWaitingContext(context.Background())
+	return assigned
+}
+
+// ReevaluateWaitingContext is ReevaluateWaiting that stops once ctx is done,
+// leaving the conversations it didn't reach waiting. It returns what was
+// assigned up to that point along with ctx's error.
+func (as *AssignmentSystem) ReevaluateWaitingContext(ctx context.Context) (map[string]string, error) {
+	as.traceOp(TraceRecord{Op: TraceReevaluate})
+	assigned := make(map[string]string)
+	now := as.clock()
+	as.startFairness()
+
+	for _, account := range slices.Sorted(maps.Keys(as.waitingConversations)) {
+		as.reevaluateAccount(ctx, account, now, assigned)
+	}
+
+	return assigned, ctx.Err()
+}
+
+// serveWaitingFirst retries the account's waiting conversations before a new
+// one of the account is placed, so new arrivals never take an agent a waiting
+// conversation could have had. Whatever still waits afterwards can't be
+// placed, and neither can the new one since it qualifies for fewer tiers.
+func (as *AssignmentSystem) serveWaitingFirst(account string) {
+	as.stateMu.Lock()
+	waiting := len(as.waitingConversations[account])
+	as.stateMu.Unlock()
+
+	if waiting > 0 {
+		as.reevaluateAccount(context.Background(), account, as.clock(), nil)
+	}
+}
+
+// reevaluateAccount retries the account's waiting conversations oldest first,
+// adding the ones it assigns to assigned when it isn't nil
+func (as *AssignmentSystem) reevaluateAccount(ctx context.Context, account string, now time.Time, assigned map[string]string) {
+	as.stateMu.Lock()
+	waiting := as.waitingConversations[account]
+	as.stateMu.Unlock()
+
+	stillWaiting := make([]waitingConversation, 0, len(waiting))
+	for _, conversation := range waiting {
+		if ctx.Err() != nil {
+			stillWaiting = append(stillWaiting, conversation)
+			continue
+		}
+
+		if conversation.AfterHours {
+			if !as.isOpen(account, now) {
+				stillWaiting = append(stillWaiting, conversation)
+				continue
+			}
+			conversation.AfterHours = false
+			conversation.WaitingSince = now
+		}
+
+		waited := now.Sub(conversation.WaitingSince)
+		agent, err := as.assign(conversation.ConversationToAssign, waited)
+		if err != nil {
+			stillWaiting = append(stillWaiting, conversation)
+			continue
+		}
+		as.recordDequeue(conversation.ConversationToAssign, agent, waited)
+
+		if assigned != nil {
+			assigned[conversation.ConversationID] = agent
+		}
+	}
+
+	as.stateMu.Lock()
+	defer as.stateMu.Unlock()
+	for _, conversation := range waiting {
+		if _, ok := as.activeConversations[conversation.ConversationID]; ok {
+			delete(as.waitingAccounts, conversation.ConversationID)
+		}
+	}
+	if len(stillWaiting) == 0 {
+		delete(as.waitingConversations, account)
+		return
+	}
+	as.waitingConversations[account] = stillWaiting
+}
+
+func (as *AssignmentSystem) hasOverflowChain(account string) bool {
+	return len(as.overflowChains[account]) > 0
+}
+
+// shouldWait reports whether a conversation that failed with err should be
+// held in the waiting list rather than rejected
+func (as *AssignmentSystem) shouldWait(account string, err error) bool {
+	switch {
+	case errors.Is(err, ErrNoAvailableAgents):
+		// The overflow chain may widen eligibility later
+		return as.hasOverflowChain(account)
+	case errors.Is(err, ErrOutsideBusinessHours):
+		return as.businessHours[account].AfterHours == QueueAfterHours
+	default:
+		return false
+	}
+}
+
+func (as *AssignmentSystem) enqueueWaiting(conversation ConversationToAssign, afterHours bool) {
+	as.stateMu.Lock()
+	defer as.stateMu.Unlock()
+
+	if as.waitingConversations == nil {
+		as.waitingConversations = make(map[string][]waitingConversation)
+	}
+	if as.waitingAccounts == nil {
+		as.waitingAccounts = make(map[string]string)
+	}
+	as.waitingAccounts[conversation.ConversationID] = conversation.Account
+	as.conversationIndex = nil
+
+	as.waitingConversations[conversation.Account] = append(as.waitingConversations[conversation.Account], waitingConversation{
+		ConversationToAssign: conversation,
+		WaitingSince:         as.clock(),
+		AfterHours:           afterHours,
+	})
+}
+
+// eligibleTeams returns the teams a conversation may be routed to after
+// waiting for the given duration. A nil result means no restriction.
+func (as *AssignmentSystem) eligibleTeams(account string, waited time.Duration) []string {
+	chain := as.overflowChains[account]
+	if len(chain) == 0 {
+		return nil
+	}
+
+	teams := make([]string, 0)
+	for _, tier := range chain {
+		if tier.After > waited {
+			break
+		}
+
+		if len(tier.Teams) == 0 { // Any agent in the account
+			return nil
+		}
+		teams = append(teams, tier.Teams...)
+	}
+
+	return teams
+}
+
+func filterWorkQueuesByTeams(workQueues []*AgentWorkQueue, teams []string) []*AgentWorkQueue {
+	if teams == nil {
+		return workQueues
+	}
+
+	filtered := make([]*AgentWorkQueue, 0, len(workQueues))
+	for _, wq := range workQueues {
+		if slices.Contains(teams, wq.Team) {
+			filtered = append(filtered, wq)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,166 @@
+package assignmentsystem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEligibleTeams(t *testing.T) {
+	system := NewAssignmentSystem(nil)
+	system.SetOverflowChain("account1", []OverflowTier{
+		{Teams: []string{"tier2"}, After: 30 * time.Second},
+		{Teams: []string{"tier1"}},
+		{After: 2 * time.Minute},
+	})
+
+	tests := []struct {
+		name        string
+		account     string
+		waited      time.Duration
+		expectation []string
+	}{
+		{
+			name:        "Account without a chain is unrestricted",
+			account:     "account2",
+			waited:      0,
+			expectation: nil,
+		},
+		{
+			name:        "New conversation only reaches the primary team",
+			account:     "account1",
+			waited:      0,
+			expectation: []string{"tier1"},
+		},
+		{
+			name:        "Crossing the first threshold adds the secondary team",
+			account:     "account1",
+			waited:      30 * time.Second,
+			expectation: []string{"tier1", "tier2"},
+		},
+		{
+			name:        "Final tier opens the whole account",
+			account:     "account1",
+			waited:      5 * time.Minute,
+			expectation: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectation, system.eligibleTeams(test.account, test.waited))
+		})
+	}
+}
+
+func TestIntegrationOverflowChainEscalation(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1, Team: "tier1"},
+		{Name: "agent2", Account: "account1", Limit: 1, Team: "tier2"},
+		{Name: "agent3", Account: "account1", Limit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetOverflowChain("account1", []OverflowTier{
+		{Teams: []string{"tier1"}},
+		{Teams: []string{"tier2"}, After: 30 * time.Second},
+		{After: time.Minute},
+	})
+
+	assignedAgents, err := system.Assign([]ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+		{ConversationID: "conv2", Account: "account1"},
+		{ConversationID: "conv3", Account: "account1"},
+	})
+
+	// Only tier1 is eligible at first, the rest wait rather than fail
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent1"}, assignedAgents)
+	assert.Len(t, system.waitingConversations["account1"], 2)
+
+	// Nothing changes before the first threshold
+	now = now.Add(10 * time.Second)
+	assert.Empty(t, system.ReevaluateWaiting())
+
+	// Tier 2 opens up for the oldest waiting conversation
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, map[string]string{"conv2": "agent2"}, system.ReevaluateWaiting())
+
+	// The whole account opens up after a minute
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, map[string]string{"conv3": "agent3"}, system.ReevaluateWaiting())
+	assert.Empty(t, system.waitingConversations)
+}
+
+func TestIntegrationOverflowChainNotConfigured(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1, Team: "tier1"},
+	})
+
+	assignedAgents, err := system.Assign([]ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+		{ConversationID: "conv2", Account: "account1"},
+	})
+
+	// Without a chain the old behaviour of failing the conversation is kept
+	assert.Error(t, err)
+	assert.Equal(t, []string{"agent1"}, assignedAgents)
+	assert.Empty(t, system.waitingConversations)
+}
+
+func TestIntegrationReevaluateWaitingOrder(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	// A single agent shared by every account, so only one waiting
+	// conversation can be assigned per re-evaluation
+	for range 20 {
+		roster := make([]AgentNameAndAccount, 0)
+		for _, account := range []string{"account3", "account1", "account2"} {
+			roster = append(roster, AgentNameAndAccount{Name: "shared", Account: account, Limit: 1})
+		}
+		system := NewAssignmentSystem(roster)
+		system.SetClock(func() time.Time { return now })
+		assert.NoError(t, system.SetStatus("shared", AgentAway))
+
+		for _, account := range []string{"account3", "account2", "account1"} {
+			system.SetOverflowChain(account, []OverflowTier{{}})
+			_, err := system.Assign([]ConversationToAssign{{ConversationID: account + "-conv", Account: account}})
+			assert.NoError(t, err)
+		}
+
+		assert.NoError(t, system.SetStatus("shared", AgentOnline))
+		assert.Equal(t, map[string]string{"account1-conv": "shared"}, system.ReevaluateWaiting())
+	}
+}
+
+func TestIntegrationWaitingConversationsGoFirst(t *testing.T) {
+	for _, matchingLimit := range []int{0, 10} {
+		system := NewAssignmentSystem([]AgentNameAndAccount{
+			{Name: "agent1", Account: "account1", Limit: 1},
+		})
+		system.SetOverflowChain("account1", []OverflowTier{{}})
+		system.SetBatchMatching(matchingLimit)
+
+		assignedAgents, err := system.Assign([]ConversationToAssign{
+			{ConversationID: "c1", Account: "account1"},
+			{ConversationID: "c2", Account: "account1"}, // Waits for agent1
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"agent1"}, assignedAgents)
+		assert.NoError(t, system.Complete("c1"))
+
+		// c2 takes the freed agent and c3 waits behind it
+		assignedAgents, err = system.Assign([]ConversationToAssign{{ConversationID: "c3", Account: "account1"}})
+		assert.NoError(t, err)
+		assert.Empty(t, assignedAgents)
+
+		conversation, err := system.Conversation("c2")
+		assert.NoError(t, err)
+		assert.Equal(t, "agent1", conversation.AgentName)
+		conversation, err = system.Conversation("c3")
+		assert.NoError(t, err)
+		assert.True(t, conversation.Waiting)
+	}
+}
@@ -0,0 +1,97 @@
+package assignmentsystem
+
+import (
+	"context"
+	"sync"
+)
+
+// SetParallelism lets Assign process the accounts of a batch concurrently on
+// up to workers goroutines. Accounts that share agents are always processed
+// together, and conversations of the same account keep their order. One or
+// less processes the batch sequentially. The system itself still isn't safe
+// for concurrent use, only a single Assign call is parallelised.
+func (as *AssignmentSystem) SetParallelism(workers int) {
+	as.parallelism = workers
+}
+
+func (as *AssignmentSystem) assignPartitioned(ctx context.Context, conversationsToAssign []ConversationToAssign, outcomes []assignmentOutcome) {
+	partitions := as.partitionBatch(conversationsToAssign)
+
+	work := make(chan []int)
+	var wg sync.WaitGroup
+	for range min(as.parallelism, len(partitions)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each partition writes to its own indexes of outcomes only
+			for indexes := range work {
+				as.assignIndexes(ctx, conversationsToAssign, indexes, outcomes)
+			}
+		}()
+	}
+
+	for _, indexes := range partitions {
+		work <- indexes
+	}
+	close(work)
+	wg.Wait()
+}
+
+// partitionBatch splits the batch into groups of conversations that never
+// touch the same agents, in the order the groups first appear
+func (as *AssignmentSystem) partitionBatch(conversationsToAssign []ConversationToAssign) [][]int {
+	partitions := make([][]int, 0)
+	partitionIndex := make(map[string]int)
+
+	for i, conversation := range conversationsToAssign {
+		key := conversation.Account
+		if group, ok := as.sharedAccountGroups[key]; ok {
+			key = group
+		}
+
+		index, ok := partitionIndex[key]
+		if !ok {
+			index = len(partitions)
+			partitionIndex[key] = index
+			partitions = append(partitions, make([]int, 0))
+		}
+		partitions[index] = append(partitions[index], i)
+	}
+
+	return partitions
+}
+
+// groupSharedAccounts links accounts that have agents in common so they end up
+// in the same partition
+func (as *AssignmentSystem) groupSharedAccounts() {
+	parent := make(map[string]string)
+	var find func(account string) string
+	find = func(account string) string {
+		if parent[account] == account {
+			return account
+		}
+		parent[account] = find(parent[account])
+		return parent[account]
+	}
+
+	for _, wq := range as.agentAssignments {
+		accounts := wq.memberAccounts()
+		if len(accounts) < 2 {
+			continue
+		}
+
+		for _, account := range accounts {
+			if _, ok := parent[account]; !ok {
+				parent[account] = account
+			}
+		}
+		for _, account := range accounts[1:] {
+			parent[find(account)] = find(accounts[0])
+		}
+	}
+
+	as.sharedAccountGroups = make(map[string]string, len(parent))
+	for account := range parent {
+		as.sharedAccountGroups[account] = find(account)
+	}
+}
@@ -0,0 +1,87 @@
+package assignmentsystem
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionBatch(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "shared1", Account: "account1", Limit: 5},
+		{Name: "shared1", Account: "account2", Limit: 5},
+		{Name: "agent2", Account: "account3", Limit: 5},
+		{Name: "shared2", Account: "account2", Limit: 5},
+		{Name: "shared2", Account: "account4", Limit: 5},
+	})
+
+	conversations := []ConversationToAssign{
+		{ConversationID: "conv1", Account: "account3"},
+		{ConversationID: "conv2", Account: "account1"},
+		{ConversationID: "conv3", Account: "account4"},
+		{ConversationID: "conv4", Account: "account3"},
+		{ConversationID: "conv5", Account: "account2"},
+		{ConversationID: "conv6", Account: "account5"},
+	}
+
+	// account1, account2 and account4 are linked through shared agents
+	assert.Equal(t, [][]int{{0, 3}, {1, 2, 4}, {5}}, system.partitionBatch(conversations))
+}
+
+func TestIntegrationParallelAssignMatchesSequential(t *testing.T) {
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(output)
+
+	random := rand.New(rand.NewSource(7))
+	agents, accounts := benchmarkRoster(random)
+	// Link a couple of accounts through a shared agent
+	agents = append(agents,
+		AgentNameAndAccount{Name: "shared", Account: accounts[0], Limit: 10},
+		AgentNameAndAccount{Name: "shared", Account: accounts[1], Limit: 10},
+	)
+
+	conversations := make([]ConversationToAssign, 5000)
+	for i := range conversations {
+		conversations[i] = ConversationToAssign{
+			ConversationID: fmt.Sprintf("conversation-%d", i+1),
+			Account:        accounts[random.Intn(len(accounts))],
+		}
+	}
+
+	// Strictly increasing clocks so ties on assignment time can't differ between the runs
+	newClock := func() func() time.Time {
+		var ticks atomic.Int64
+		start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+		return func() time.Time {
+			return start.Add(time.Duration(ticks.Add(1)) * time.Millisecond)
+		}
+	}
+
+	sequential := NewAssignmentSystem(agents)
+	sequential.SetClock(newClock())
+	parallel := NewAssignmentSystem(agents)
+	parallel.SetClock(newClock())
+	parallel.SetParallelism(8)
+
+	for start := 0; start < len(conversations); start += 500 {
+		batch := conversations[start : start+500]
+
+		expectedAgents, expectedErr := sequential.Assign(batch)
+		assignedAgents, err := parallel.Assign(batch)
+
+		assert.Equal(t, expectedAgents, assignedAgents)
+		assert.Equal(t, expectedErr, err)
+	}
+	assert.Len(t, parallel.activeConversations, len(sequential.activeConversations))
+}
+
+func BenchmarkAssignParallel(b *testing.B) {
+	benchmarkAssign(b, 0, 8)
+}
@@ -0,0 +1,278 @@
+package assignmentsystem
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// AgentDetail is a copy of an agent's state
+type AgentDetail struct {
+	AgentName     string         `json:"agent_name"`
+	Accounts      []string       `json:"accounts"`
+	Team          string         `json:"team,omitempty"`
+	Status        AgentStatus    `json:"status"`
+	Limit         int            `json:"limit"`
+	AccountLimits map[string]int `json:"account_limits,omitempty"`
+
+	Conversations []string `json:"conversations"` // In progress, oldest first
+	WrapUpSlots   int      `json:"wrap_up_slots"` // Held for after-call work
+	FreeSlots     int      `json:"free_slots"`    // Left under the limit, whatever the status
+
+	LastAssignment *time.Time `json:"last_assignment,omitempty"`
+	LastCompletion *time.Time `json:"last_completion,omitempty"`
+	BusySince      *time.Time `json:"busy_since,omitempty"`
+}
+
+// AccountSummary is how much room an account has. Agents shared with other
+// accounts count in full towards each of them.
+type AccountSummary struct {
+	Account string `json:"account"`
+	Open    bool   `json:"open"` // Within business hours
+	Agents  int    `json:"agents"`
+	Online  int    `json:"online"`
+
+	Capacity  int `json:"capacity"`  // Limits of the online agents
+	Used      int `json:"used"`      // Conversations and wrap-up slots of the online agents
+	Available int `json:"available"` // Slots the account's next conversations could go to
+	Waiting   int `json:"waiting"`   // Conversations waiting for an agent
+}
+
+// ConversationDetail is where a conversation stands, in progress with an
+// agent or waiting for one
+type ConversationDetail struct {
+	ConversationID string     `json:"conversation_id"`
+	Account        string     `json:"account"`
+	AgentName      string     `json:"agent_name,omitempty"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	Waiting        bool       `json:"waiting"`
+	WaitingSince   *time.Time `json:"waiting_since,omitempty"`
+}
+
+// PageRequest asks for up to Limit items that sort after After, the Next of
+// the previous page. An empty After starts from the beginning and a Limit of
+// zero gets the default page size.
+type PageRequest struct {
+	After string
+	Limit int
+}
+
+// Page is one page of a listing. Next is the After of the following page, and
+// empty on the last page.
+type Page[T any] struct {
+	Items []T    `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+// Agent returns a copy of an agent's state
+func (as *AssignmentSystem) Agent(agentName string) (AgentDetail, error) {
+	wq, ok := as.agentAssignments[agentName]
+	if !ok {
+		return AgentDetail{}, fmt.Errorf("%w: %s", ErrUnknownAgent, agentName)
+	}
+
+	return agentDetail(wq, as.clock()), nil
+}
+
+// AccountSummary returns how much room an account has right now
+func (as *AssignmentSystem) AccountSummary(account string) (AccountSummary, error) {
+	if _, ok := as.accountAgents[account]; !ok {
+		return AccountSummary{}, fmt.Errorf("%w: %s", ErrUnknownAccount, account)
+	}
+
+	return as.accountSummary(account, as.clock()), nil
+}
+
+// Conversation looks up which agent a conversation is with, or whether it is
+// waiting for one. Conversations that completed or failed are unknown.
+func (as *AssignmentSystem) Conversation(conversationID string) (ConversationDetail, error) {
+	if active, ok := as.activeConversations[conversationID]; ok {
+		return activeDetail(conversationID, active), nil
+	}
+
+	if account, ok := as.waitingAccounts[conversationID]; ok {
+		for _, conversation := range as.waitingConversations[account] {
+			if conversation.ConversationID == conversationID {
+				return waitingDetail(conversation), nil
+			}
+		}
+	}
+
+	return ConversationDetail{}, fmt.Errorf("%w: %s", ErrUnknownConversation, conversationID)
+}
+
+// ListAgents pages through an account's agents, or every agent when account
+// is empty, in name order
+func (as *AssignmentSystem) ListAgents(account string, request PageRequest) (Page[AgentDetail], error) {
+	var names []string
+	if account == "" {
+		names = slices.Sorted(maps.Keys(as.agentAssignments))
+	} else {
+		agents, ok := as.accountAgents[account]
+		if !ok {
+			return Page[AgentDetail]{}, fmt.Errorf("%w: %s", ErrUnknownAccount, account)
+		}
+		names = slices.Sorted(slices.Values(agents))
+	}
+
+	now := as.clock()
+	return paginate(names, request, func(name string) AgentDetail {
+		return agentDetail(as.agentAssignments[name], now)
+	}), nil
+}
+
+// ListAccounts pages through the summaries of every account in name order
+func (as *AssignmentSystem) ListAccounts(request PageRequest) Page[AccountSummary] {
+	now := as.clock()
+	return paginate(slices.Sorted(maps.Keys(as.accountAgents)), request, func(account string) AccountSummary {
+		return as.accountSummary(account, now)
+	})
+}
+
+// ListConversations pages through an account's conversations, or every
+// conversation when account is empty, both in progress and waiting, in ID
+// order. The sorted IDs are kept until a conversation starts, ends or starts
+// waiting, so paging through a system that isn't taking work costs a lookup
+// per page, while on a busy one each page sorts the IDs again.
+func (as *AssignmentSystem) ListConversations(account string, request PageRequest) Page[ConversationDetail] {
+	return paginate(as.conversationIDs(account), request, func(id string) ConversationDetail {
+		detail, _ := as.Conversation(id)
+		return detail
+	})
+}
+
+// conversationIDs returns the sorted IDs of the account's conversations, or of
+// every conversation when account is empty, from the index when it is current
+func (as *AssignmentSystem) conversationIDs(account string) []string {
+	as.stateMu.Lock()
+	defer as.stateMu.Unlock()
+
+	if ids, ok := as.conversationIndex[account]; ok {
+		return ids
+	}
+
+	ids := make([]string, 0)
+	for id, active := range as.activeConversations {
+		if account == "" || active.Account == account {
+			ids = append(ids, id)
+		}
+	}
+	for id, waitingAccount := range as.waitingAccounts {
+		_, active := as.activeConversations[id] // Assigned while being re-evaluated
+		if !active && (account == "" || waitingAccount == account) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	if as.conversationIndex == nil {
+		as.conversationIndex = make(map[string][]string)
+	}
+	as.conversationIndex[account] = ids
+	return ids
+}
+
+// paginate picks the page of sorted keys the request asks for and describes
+// each of them
+func paginate[T any](keys []string, request PageRequest, describe func(string) T) Page[T] {
+	limit := request.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	start := 0
+	if request.After != "" {
+		start = sort.Search(len(keys), func(i int) bool { return keys[i] > request.After })
+	}
+	end := min(start+limit, len(keys))
+
+	page := Page[T]{Items: make([]T, 0, end-start)}
+	for _, key := range keys[start:end] {
+		page.Items = append(page.Items, describe(key))
+	}
+	if end < len(keys) {
+		page.Next = keys[end-1]
+	}
+
+	return page
+}
+
+func agentDetail(wq *AgentWorkQueue, now time.Time) AgentDetail {
+	wrapUp := wq.slotsInWrapUp(now)
+	return AgentDetail{
+		AgentName:      wq.AgentName,
+		Accounts:       slices.Clone(wq.memberAccounts()),
+		Team:           wq.Team,
+		Status:         wq.Status,
+		Limit:          wq.Limit,
+		AccountLimits:  maps.Clone(wq.AccountLimits),
+		Conversations:  slices.Clone(wq.Queue),
+		WrapUpSlots:    wrapUp,
+		FreeSlots:      max(0, wq.Limit-len(wq.Queue)-wrapUp),
+		LastAssignment: copyTime(wq.LastAssignmentTime),
+		LastCompletion: copyTime(wq.LastCompletionTime),
+		BusySince:      copyTime(wq.BusySince),
+	}
+}
+
+func (as *AssignmentSystem) accountSummary(account string, now time.Time) AccountSummary {
+	summary := AccountSummary{
+		Account: account,
+		Open:    as.isOpen(account, now),
+		Agents:  len(as.accountAgents[account]),
+		Waiting: len(as.waitingConversations[account]),
+	}
+
+	for _, agentName := range as.accountAgents[account] {
+		wq := as.agentAssignments[agentName]
+		if wq.Status != AgentOnline {
+			continue
+		}
+
+		summary.Online++
+		summary.Capacity += wq.Limit
+		summary.Used += len(wq.Queue) + wq.slotsInWrapUp(now)
+		summary.Available += max(0, wq.room(account, now))
+	}
+
+	return summary
+}
+
+func activeDetail(conversationID string, active activeConversation) ConversationDetail {
+	startedAt := active.StartedAt
+	return ConversationDetail{
+		ConversationID: conversationID,
+		Account:        active.Account,
+		AgentName:      active.AgentName,
+		StartedAt:      &startedAt,
+	}
+}
+
+func waitingDetail(conversation waitingConversation) ConversationDetail {
+	detail := ConversationDetail{
+		ConversationID: conversation.ConversationID,
+		Account:        conversation.Account,
+		Waiting:        true,
+	}
+	if !conversation.AfterHours { // The wait only starts once the account opens
+		detail.WaitingSince = copyTime(&conversation.WaitingSince)
+	}
+
+	return detail
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
@@ -0,0 +1,193 @@
+package assignmentsystem
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrationQuery(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2},
+		{Name: "agent2", Account: "account1", Limit: 3},
+		{Name: "agent3", Account: "account1", Limit: 1},
+		{Name: "agent4", Account: "account2", Limit: 1},
+		{Name: "agent2", Account: "account2", AccountLimit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetWrapUpDuration("account1", 30*time.Second)
+	system.SetOverflowChain("account2", []OverflowTier{{}})
+	assert.NoError(t, system.SetStatus("agent3", AgentAway))
+
+	// agent1 wraps up after a1, agent4 and agent2 take a conversation of
+	// account2 each and b3 waits as agent2 is at its limit for account2
+	_, err := system.Assign([]ConversationToAssign{{ConversationID: "a1", Account: "account1"}})
+	assert.NoError(t, err)
+	assert.NoError(t, system.Complete("a1"))
+	_, err = system.Assign([]ConversationToAssign{
+		{ConversationID: "b1", Account: "account2"},
+		{ConversationID: "b2", Account: "account2"},
+		{ConversationID: "b3", Account: "account2"},
+	})
+	assert.NoError(t, err)
+
+	agent, err := system.Agent("agent2")
+	assert.NoError(t, err)
+	assert.Equal(t, AgentDetail{
+		AgentName:      "agent2",
+		Accounts:       []string{"account1", "account2"},
+		Status:         AgentOnline,
+		Limit:          3,
+		AccountLimits:  map[string]int{"account2": 1},
+		Conversations:  []string{"b2"},
+		FreeSlots:      2,
+		LastAssignment: &now,
+		BusySince:      &now,
+	}, agent)
+
+	// Changing the copy leaves the system alone
+	agent.Conversations[0] = "changed"
+	agent.AccountLimits["account2"] = 5
+	*agent.LastAssignment = now.Add(time.Hour)
+	agent, err = system.Agent("agent2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b2"}, agent.Conversations)
+	assert.Equal(t, 1, agent.AccountLimits["account2"])
+	assert.Equal(t, now, *agent.LastAssignment)
+
+	agent, err = system.Agent("agent1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, agent.WrapUpSlots)
+	assert.Equal(t, 1, agent.FreeSlots)
+
+	_, err = system.Agent("agent9")
+	assert.ErrorIs(t, err, ErrUnknownAgent)
+
+	summary, err := system.AccountSummary("account1")
+	assert.NoError(t, err)
+	assert.Equal(t, AccountSummary{Account: "account1", Open: true, Agents: 3, Online: 2, Capacity: 5, Used: 2, Available: 3}, summary)
+	summary, err = system.AccountSummary("account2")
+	assert.NoError(t, err)
+	assert.Equal(t, AccountSummary{Account: "account2", Open: true, Agents: 2, Online: 2, Capacity: 4, Used: 2, Available: 0, Waiting: 1}, summary)
+	_, err = system.AccountSummary("account9")
+	assert.ErrorIs(t, err, ErrUnknownAccount)
+
+	conversation, err := system.Conversation("b2")
+	assert.NoError(t, err)
+	assert.Equal(t, ConversationDetail{ConversationID: "b2", Account: "account2", AgentName: "agent2", StartedAt: &now}, conversation)
+	conversation, err = system.Conversation("b3")
+	assert.NoError(t, err)
+	assert.Equal(t, ConversationDetail{ConversationID: "b3", Account: "account2", Waiting: true, WaitingSince: &now}, conversation)
+	_, err = system.Conversation("a1") // Completed
+	assert.ErrorIs(t, err, ErrUnknownConversation)
+
+	conversations := system.ListConversations("account2", PageRequest{})
+	assert.Len(t, conversations.Items, 3)
+	assert.Equal(t, "b1", conversations.Items[0].ConversationID)
+	assert.True(t, conversations.Items[2].Waiting)
+	assert.Empty(t, system.ListConversations("account1", PageRequest{}).Items)
+
+	accounts := system.ListAccounts(PageRequest{Limit: 1})
+	assert.Equal(t, []AccountSummary{{Account: "account1", Open: true, Agents: 3, Online: 2, Capacity: 5, Used: 2, Available: 3}}, accounts.Items)
+	assert.Equal(t, "account1", accounts.Next)
+	accounts = system.ListAccounts(PageRequest{After: accounts.Next, Limit: 1})
+	assert.Equal(t, "account2", accounts.Items[0].Account)
+	assert.Empty(t, accounts.Next)
+}
+
+func TestListAgentsPagination(t *testing.T) {
+	roster := make([]AgentNameAndAccount, 0)
+	for i := range 25 {
+		roster = append(roster, AgentNameAndAccount{Name: fmt.Sprintf("agent%02d", i), Account: "account1", Limit: 1})
+	}
+	roster = append(roster, AgentNameAndAccount{Name: "other", Account: "account2", Limit: 1})
+	system := NewAssignmentSystem(roster)
+
+	names := make([]string, 0)
+	pages := 0
+	request := PageRequest{Limit: 10}
+	for {
+		page, err := system.ListAgents("account1", request)
+		assert.NoError(t, err)
+		pages++
+		for _, agent := range page.Items {
+			names = append(names, agent.AgentName)
+		}
+		if page.Next == "" {
+			break
+		}
+		request.After = page.Next
+	}
+	assert.Equal(t, 3, pages)
+	assert.Len(t, names, 25)
+	assert.Equal(t, "agent00", names[0])
+	assert.Equal(t, "agent24", names[24])
+
+	all, err := system.ListAgents("", PageRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, all.Items, 26)
+	assert.Empty(t, all.Next)
+
+	past, err := system.ListAgents("account1", PageRequest{After: "agent24"})
+	assert.NoError(t, err)
+	assert.Empty(t, past.Items)
+
+	_, err = system.ListAgents("account9", PageRequest{})
+	assert.ErrorIs(t, err, ErrUnknownAccount)
+}
+
+func TestListConversationsPagination(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 20},
+		{Name: "agent2", Account: "account2", Limit: 1},
+	})
+	system.SetOverflowChain("account2", []OverflowTier{{}})
+
+	batch := make([]ConversationToAssign, 0)
+	for i := range 15 {
+		batch = append(batch, ConversationToAssign{ConversationID: fmt.Sprintf("a%02d", i), Account: "account1"})
+	}
+	for i := range 5 {
+		batch = append(batch, ConversationToAssign{ConversationID: fmt.Sprintf("b%02d", i), Account: "account2"}) // All but b00 wait
+	}
+	_, err := system.Assign(batch)
+	assert.NoError(t, err)
+
+	ids := make([]string, 0)
+	waiting := 0
+	request := PageRequest{Limit: 8}
+	for {
+		page := system.ListConversations("", request)
+		for _, conversation := range page.Items {
+			ids = append(ids, conversation.ConversationID)
+			if conversation.Waiting {
+				waiting++
+			}
+		}
+		if page.Next == "" {
+			break
+		}
+		request.After = page.Next
+
+		// Conversations arriving between pages show up in the later ones
+		if len(ids) == 8 {
+			_, err := system.Assign([]ConversationToAssign{{ConversationID: "c00", Account: "account1"}})
+			assert.NoError(t, err)
+		}
+	}
+	assert.Len(t, ids, 21)
+	assert.Equal(t, "a00", ids[0])
+	assert.Equal(t, "c00", ids[20])
+	assert.Equal(t, 4, waiting)
+
+	// Completing b00 lets b01 go to agent2
+	assert.NoError(t, system.Complete("b00"))
+	system.ReevaluateWaiting()
+	conversations := system.ListConversations("account2", PageRequest{})
+	assert.Len(t, conversations.Items, 4)
+	assert.Equal(t, "agent2", conversations.Items[0].AgentName)
+	assert.True(t, conversations.Items[1].Waiting)
+}
@@ -0,0 +1,139 @@
+package assignmentsystem
+
+import (
+	"time"
+)
+
+// occupancyWindow is how far back occupancy looks when comparing agents
+const occupancyWindow = time.Hour
+
+// SelectionMode picks between the least loaded agents of an account
+type SelectionMode int
+
+const (
+	// SelectLeastRecentAssignment favours the agent assigned to longest ago
+	SelectLeastRecentAssignment SelectionMode = iota
+	// SelectLongestIdle favours the agent whose last conversation ended longest ago
+	SelectLongestIdle
+	// SelectLowestOccupancy favours the agent who spent the least of the last hour busy
+	SelectLowestOccupancy
+)
+
+// BusyPeriod is a stretch of time during which an agent had at least one
+// conversation
+type BusyPeriod struct {
+	Start time.Time
+	End   time.Time
+}
+
+// SetSelectionMode changes how an account breaks ties between agents with the
+// same amount of work
+func (as *AssignmentSystem) SetSelectionMode(account string, mode SelectionMode) {
+	if as.selectionModes == nil {
+		as.selectionModes = make(map[string]SelectionMode)
+	}
+
+	as.selectionModes[account] = mode
+}
+
+// selectWorkQueue picks one of the least loaded work queues the way the mode
+// says to
+func (as *AssignmentSystem) selectWorkQueue(mode SelectionMode, workQueues []*AgentWorkQueue) *AgentWorkQueue {
+	if len(workQueues) == 1 {
+		return workQueues[0]
+	}
+
+	switch mode {
+	case SelectLongestIdle:
+		return getWorkQueueWithTheLongestIdle(workQueues)
+	case SelectLowestOccupancy:
+		return getWorkQueueWithTheLowestOccupancy(workQueues, as.clock())
+	}
+
+	// pick the one with longest now - assignmentTime
+	return getWorkQueueWithTheLeastRecentAssignment(workQueues, as.clock())
+}
+
+// recordCompletion updates the idle and busy tracking once a conversation has
+// been removed from the queue
+func (wq *AgentWorkQueue) recordCompletion(now time.Time) {
+	wq.LastCompletionTime = &now
+
+	if len(wq.Queue) > 0 || wq.BusySince == nil {
+		return
+	}
+
+	wq.BusyPeriods = append(wq.BusyPeriods, BusyPeriod{Start: *wq.BusySince, End: now})
+	wq.BusySince = nil
+
+	// Only the occupancy window is ever looked at
+	cutoff := now.Add(-occupancyWindow)
+	kept := wq.BusyPeriods[:0]
+	for _, period := range wq.BusyPeriods {
+		if period.End.After(cutoff) {
+			kept = append(kept, period)
+		}
+	}
+	wq.BusyPeriods = kept
+}
+
+// occupancy returns the fraction of the occupancy window the agent was busy
+func (wq *AgentWorkQueue) occupancy(now time.Time) float64 {
+	windowStart := now.Add(-occupancyWindow)
+	var busy time.Duration
+
+	for _, period := range wq.BusyPeriods {
+		busy += overlap(period.Start, period.End, windowStart, now)
+	}
+
+	if wq.BusySince != nil {
+		busy += overlap(*wq.BusySince, now, windowStart, now)
+	}
+
+	return float64(busy) / float64(occupancyWindow)
+}
+
+func overlap(start, end, windowStart, windowEnd time.Time) time.Duration {
+	if start.Before(windowStart) {
+		start = windowStart
+	}
+	if end.After(windowEnd) {
+		end = windowEnd
+	}
+	if !end.After(start) {
+		return 0
+	}
+
+	return end.Sub(start)
+}
+
+func getWorkQueueWithTheLongestIdle(workQueues []*AgentWorkQueue) *AgentWorkQueue {
+	var workQueueIdleLongest *AgentWorkQueue
+
+	for _, wq := range workQueues {
+		if wq.LastCompletionTime == nil { // Never finished a conversation, nobody can have been idle longer
+			return wq
+		}
+
+		if workQueueIdleLongest == nil || wq.LastCompletionTime.Before(*workQueueIdleLongest.LastCompletionTime) {
+			workQueueIdleLongest = wq
+		}
+	}
+
+	return workQueueIdleLongest
+}
+
+func getWorkQueueWithTheLowestOccupancy(workQueues []*AgentWorkQueue, now time.Time) *AgentWorkQueue {
+	var workQueueWithLowestOccupancy *AgentWorkQueue
+	lowestOccupancy := 0.0
+
+	for _, wq := range workQueues {
+		occupancy := wq.occupancy(now)
+		if workQueueWithLowestOccupancy == nil || occupancy < lowestOccupancy {
+			workQueueWithLowestOccupancy = wq
+			lowestOccupancy = occupancy
+		}
+	}
+
+	return workQueueWithLowestOccupancy
+}
@@ -0,0 +1,127 @@
+package assignmentsystem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetWorkQueueWithTheLongestIdle(t *testing.T) {
+	now := time.Now()
+	oneMinuteAgo := now.Add(-1 * time.Minute)
+	tenMinutesAgo := now.Add(-10 * time.Minute)
+
+	tests := []struct {
+		name        string
+		input       []*AgentWorkQueue
+		expectation *AgentWorkQueue
+	}{
+		{
+			name:        "Empty input",
+			input:       []*AgentWorkQueue{},
+			expectation: nil,
+		},
+		{
+			name: "Earliest completion wins",
+			input: []*AgentWorkQueue{
+				{AgentName: "agent1", LastCompletionTime: &oneMinuteAgo},
+				{AgentName: "agent2", LastCompletionTime: &tenMinutesAgo},
+			},
+			expectation: &AgentWorkQueue{AgentName: "agent2", LastCompletionTime: &tenMinutesAgo},
+		},
+		{
+			name: "Never completed a conversation is prioritized",
+			input: []*AgentWorkQueue{
+				{AgentName: "agent1", LastCompletionTime: &tenMinutesAgo},
+				{AgentName: "agent2"},
+			},
+			expectation: &AgentWorkQueue{AgentName: "agent2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectation, getWorkQueueWithTheLongestIdle(test.input))
+		})
+	}
+}
+
+func TestOccupancy(t *testing.T) {
+	now := time.Now()
+	busySince := now.Add(-15 * time.Minute)
+
+	tests := []struct {
+		name        string
+		input       *AgentWorkQueue
+		expectation float64
+	}{
+		{
+			name:        "Never busy",
+			input:       &AgentWorkQueue{},
+			expectation: 0,
+		},
+		{
+			name:        "Currently busy counts up to now",
+			input:       &AgentWorkQueue{BusySince: &busySince},
+			expectation: 0.25,
+		},
+		{
+			name: "Periods are clipped to the last hour",
+			input: &AgentWorkQueue{
+				BusyPeriods: []BusyPeriod{
+					{Start: now.Add(-90 * time.Minute), End: now.Add(-45 * time.Minute)},
+					{Start: now.Add(-30 * time.Minute), End: now.Add(-15 * time.Minute)},
+				},
+			},
+			expectation: 0.5,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.InDelta(t, test.expectation, test.input.occupancy(now), 0.0001)
+		})
+	}
+}
+
+func TestIntegrationLongestIdleSelection(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	newSystem := func(mode SelectionMode) *AssignmentSystem {
+		system := NewAssignmentSystem([]AgentNameAndAccount{
+			{Name: "agent1", Account: "account1", Limit: 1},
+			{Name: "agent2", Account: "account1", Limit: 1},
+		})
+		system.SetClock(func() time.Time { return now })
+		system.SetSelectionMode("account1", mode)
+		return &system
+	}
+
+	for _, test := range []struct {
+		mode        SelectionMode
+		expectation string
+	}{
+		{mode: SelectLeastRecentAssignment, expectation: "agent1"},
+		{mode: SelectLongestIdle, expectation: "agent2"},
+		{mode: SelectLowestOccupancy, expectation: "agent2"},
+	} {
+		now = time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+		system := newSystem(test.mode)
+
+		// agent1 gets a 40 minute conversation, agent2 a 2 second one shortly before it ends
+		_, err := system.Assign([]ConversationToAssign{{ConversationID: "long", Account: "account1"}})
+		assert.NoError(t, err)
+		now = now.Add(39 * time.Minute)
+		_, err = system.Assign([]ConversationToAssign{{ConversationID: "short", Account: "account1"}})
+		assert.NoError(t, err)
+		now = now.Add(2 * time.Second)
+		assert.NoError(t, system.Complete("short"))
+		now = now.Add(time.Minute)
+		assert.NoError(t, system.Complete("long"))
+
+		assignedAgents, err := system.Assign([]ConversationToAssign{{ConversationID: "next", Account: "account1"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{test.expectation}, assignedAgents)
+	}
+}
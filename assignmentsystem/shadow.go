@@ -0,0 +1,110 @@
+package assignmentsystem
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// ShadowStats compares the agents a candidate selection mode would have picked
+// with the agents an account's conversations were actually assigned to
+type ShadowStats struct {
+	Account   string        `json:"account"`
+	Candidate SelectionMode `json:"candidate"`
+	Since     time.Time     `json:"since"`
+
+	// Assignments the candidate was evaluated on
+	Decisions int `json:"decisions"`
+	// Decisions where more than one agent had the least work, the only ones
+	// where selection modes can disagree
+	TieBreaks int `json:"tie_breaks"`
+	// Decisions where the candidate would have picked a different agent
+	Diverged       int     `json:"diverged"`
+	DivergenceRate float64 `json:"divergence_rate"` // Diverged over Decisions
+
+	// How many more conversations each agent would have been given by the
+	// candidate than it was, for the agents where the two differ. The
+	// candidate's picks are made against the real state, so this says where
+	// its choices lean rather than what running it would have led to.
+	AgentDifference map[string]int `json:"agent_difference,omitempty"`
+}
+
+// SetShadowSelectionMode evaluates a candidate selection mode for an account
+// without acting on it. Every assignment made for the account also works out
+// which agent the candidate would have chosen from the same work queues, and
+// how often the two disagree is kept in the account's ShadowStats. Setting a
+// candidate starts its statistics afresh.
+func (as *AssignmentSystem) SetShadowSelectionMode(account string, candidate SelectionMode) {
+	if as.shadows == nil {
+		as.shadows = make(map[string]*ShadowStats)
+	}
+
+	as.shadows[account] = &ShadowStats{
+		Account:         account,
+		Candidate:       candidate,
+		Since:           as.clock(),
+		AgentDifference: make(map[string]int),
+	}
+}
+
+// ClearShadowSelectionMode stops evaluating the account's candidate selection
+// mode and drops its statistics
+func (as *AssignmentSystem) ClearShadowSelectionMode(account string) {
+	delete(as.shadows, account)
+}
+
+// ShadowStats returns how the account's candidate selection mode compared so
+// far, or false if it has none
+func (as *AssignmentSystem) ShadowStats(account string) (ShadowStats, bool) {
+	stats, ok := as.shadows[account]
+	if !ok {
+		return ShadowStats{}, false
+	}
+
+	return stats.copy(), true
+}
+
+// ShadowStatsByAccount returns the statistics of every account with a
+// candidate selection mode, in account name order
+func (as *AssignmentSystem) ShadowStatsByAccount() []ShadowStats {
+	all := make([]ShadowStats, 0, len(as.shadows))
+	for _, account := range slices.Sorted(maps.Keys(as.shadows)) {
+		all = append(all, as.shadows[account].copy())
+	}
+
+	return all
+}
+
+// compareShadow records what the account's candidate selection mode would
+// have picked out of the least loaded work queues, before the chosen one is
+// assigned to and the state moves on
+func (as *AssignmentSystem) compareShadow(account string, leastLoaded []*AgentWorkQueue, chosen *AgentWorkQueue) {
+	stats, ok := as.shadows[account]
+	if !ok {
+		return
+	}
+
+	stats.Decisions++
+	if len(leastLoaded) > 1 {
+		stats.TieBreaks++
+	}
+
+	candidate := as.selectWorkQueue(stats.Candidate, leastLoaded)
+	if candidate != chosen {
+		stats.Diverged++
+		stats.AgentDifference[candidate.AgentName]++
+		stats.AgentDifference[chosen.AgentName]--
+		for _, agent := range []string{candidate.AgentName, chosen.AgentName} {
+			if stats.AgentDifference[agent] == 0 {
+				delete(stats.AgentDifference, agent)
+			}
+		}
+	}
+	stats.DivergenceRate = float64(stats.Diverged) / float64(stats.Decisions)
+}
+
+func (stats *ShadowStats) copy() ShadowStats {
+	copied := *stats
+	copied.AgentDifference = maps.Clone(stats.AgentDifference)
+	return copied
+}
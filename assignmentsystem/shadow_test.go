@@ -0,0 +1,98 @@
+package assignmentsystem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrationShadowSelectionMode(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+		{Name: "agent2", Account: "account1", Limit: 1},
+		{Name: "agent3", Account: "account2", Limit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetShadowSelectionMode("account1", SelectLongestIdle)
+	system.SetShadowSelectionMode("account2", SelectLowestOccupancy)
+
+	_, ok := system.ShadowStats("account3")
+	assert.False(t, ok)
+
+	// agent1 gets a 40 minute conversation, agent2 a 2 second one shortly before it ends
+	_, err := system.Assign([]ConversationToAssign{{ConversationID: "long", Account: "account1"}})
+	assert.NoError(t, err)
+	now = now.Add(39 * time.Minute)
+	_, err = system.Assign([]ConversationToAssign{{ConversationID: "short", Account: "account1"}})
+	assert.NoError(t, err)
+	now = now.Add(2 * time.Second)
+	assert.NoError(t, system.Complete("short"))
+	now = now.Add(time.Minute)
+	assert.NoError(t, system.Complete("long"))
+
+	// Longest idle would pick agent2, the live mode still picks agent1
+	assignedAgents, err := system.Assign([]ConversationToAssign{{ConversationID: "next", Account: "account1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent1"}, assignedAgents)
+
+	stats, ok := system.ShadowStats("account1")
+	assert.True(t, ok)
+	assert.Equal(t, ShadowStats{
+		Account:         "account1",
+		Candidate:       SelectLongestIdle,
+		Since:           time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC),
+		Decisions:       3,
+		TieBreaks:       2,
+		Diverged:        1,
+		DivergenceRate:  1.0 / 3,
+		AgentDifference: map[string]int{"agent1": -1, "agent2": 1},
+	}, stats)
+
+	// The returned statistics are a copy
+	stats.AgentDifference["agent1"] = 5
+	stats, _ = system.ShadowStats("account1")
+	assert.Equal(t, -1, stats.AgentDifference["agent1"])
+
+	all := system.ShadowStatsByAccount()
+	assert.Len(t, all, 2)
+	assert.Equal(t, "account1", all[0].Account)
+	assert.Equal(t, ShadowStats{
+		Account:         "account2",
+		Candidate:       SelectLowestOccupancy,
+		Since:           time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC),
+		AgentDifference: map[string]int{},
+	}, all[1])
+
+	// Setting a candidate again starts afresh, clearing it stops the comparison
+	system.SetShadowSelectionMode("account1", SelectLeastRecentAssignment)
+	stats, _ = system.ShadowStats("account1")
+	assert.Zero(t, stats.Decisions)
+
+	system.ClearShadowSelectionMode("account1")
+	_, ok = system.ShadowStats("account1")
+	assert.False(t, ok)
+	assert.Len(t, system.ShadowStatsByAccount(), 1)
+}
+
+func TestShadowOfTheLiveModeNeverDiverges(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2},
+		{Name: "agent2", Account: "account1", Limit: 2},
+		{Name: "agent3", Account: "account1", Limit: 2},
+	})
+	system.SetShadowSelectionMode("account1", SelectLeastRecentAssignment)
+
+	conversations := make([]ConversationToAssign, 0)
+	for _, id := range []string{"c1", "c2", "c3", "c4", "c5", "c6"} {
+		conversations = append(conversations, ConversationToAssign{ConversationID: id, Account: "account1"})
+	}
+	_, err := system.Assign(conversations)
+	assert.NoError(t, err)
+
+	stats, _ := system.ShadowStats("account1")
+	assert.Equal(t, 6, stats.Decisions)
+	assert.Zero(t, stats.Diverged)
+	assert.Empty(t, stats.AgentDifference)
+}
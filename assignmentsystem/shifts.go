@@ -0,0 +1,150 @@
+package assignmentsystem
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Break is a period within a shift during which the agent is away
+type Break struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Shift is a period an agent works. Limit overrides the agent's usual limit
+// for the shift when set, and StopAssigningBefore stops new conversations that
+// long before End so the agent can finish the ones they have.
+type Shift struct {
+	Start               time.Time
+	End                 time.Time
+	Breaks              []Break
+	Limit               int
+	StopAssigningBefore time.Duration
+}
+
+type shiftSchedule struct {
+	Shifts    []Shift
+	BaseLimit int         // The limit to restore outside of shifts and for shifts without one
+	Applied   *shiftState // What ApplyShifts last set, nil until it first runs
+}
+
+// shiftState is what a schedule wants the agent's status and limit to be
+type shiftState struct {
+	Status AgentStatus
+	Limit  int
+}
+
+// SetShifts loads an agent's shift schedule. From then on ApplyShifts drives
+// the agent's status and limit, replacing the schedule loaded before. The
+// next ApplyShifts applies the new schedule whatever the agent's state.
+func (as *AssignmentSystem) SetShifts(agentName string, shifts []Shift) error {
+	wq, ok := as.agentAssignments[agentName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAgent, agentName)
+	}
+
+	if as.agentShifts == nil {
+		as.agentShifts = make(map[string]*shiftSchedule)
+	}
+
+	baseLimit := wq.Limit
+	if existing, ok := as.agentShifts[agentName]; ok {
+		baseLimit = existing.BaseLimit
+	}
+
+	sorted := slices.Clone(shifts)
+	slices.SortFunc(sorted, func(a, b Shift) int { return a.Start.Compare(b.Start) })
+	as.agentShifts[agentName] = &shiftSchedule{
+		Shifts:    sorted,
+		BaseLimit: baseLimit,
+	}
+
+	return nil
+}
+
+// ClearShifts stops driving the agent from a schedule and restores its limit.
+// The agent's status is left as it was.
+func (as *AssignmentSystem) ClearShifts(agentName string) {
+	schedule, ok := as.agentShifts[agentName]
+	if !ok {
+		return
+	}
+
+	if as.agentAssignments[agentName].Limit != schedule.BaseLimit {
+		as.SetLimit(agentName, schedule.BaseLimit)
+	}
+	delete(as.agentShifts, agentName)
+}
+
+// ApplyShifts brings every scheduled agent's status and limit in line with
+// their schedule at the current time. It is meant to be called periodically,
+// e.g. once per assignment batch. Only transitions are applied: once a shift,
+// break or closing period has started, SetStatus and SetLimit can override
+// the agent until the schedule reaches its next boundary.
+func (as *AssignmentSystem) ApplyShifts() {
+	_ = as.ApplyShiftsContext(context.Background())
+}
+
+// ApplyShiftsContext is ApplyShifts that stops once ctx is done. Agents not
+// reached keep their current state until the next call. Agents are visited in
+// name order and changes go through SetStatus and SetLimit, so a trace records
+// them as they happen.
+func (as *AssignmentSystem) ApplyShiftsContext(ctx context.Context) error {
+	now := as.clock()
+
+	for _, agentName := range slices.Sorted(maps.Keys(as.agentShifts)) {
+		schedule := as.agentShifts[agentName]
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		status, limit := schedule.stateAt(now)
+		state := shiftState{Status: status, Limit: limit}
+		if schedule.Applied != nil && *schedule.Applied == state {
+			continue // No boundary crossed since the last call
+		}
+		schedule.Applied = &state
+
+		wq := as.agentAssignments[agentName]
+		if wq.Status != status {
+			if err := as.SetStatus(agentName, status); err != nil {
+				return err
+			}
+		}
+		if wq.Limit != limit {
+			as.SetLimit(agentName, limit)
+		}
+	}
+
+	return nil
+}
+
+func (ss *shiftSchedule) stateAt(now time.Time) (AgentStatus, int) {
+	for _, shift := range ss.Shifts {
+		if now.Before(shift.Start) || !now.Before(shift.End) {
+			continue
+		}
+
+		limit := ss.BaseLimit
+		if shift.Limit > 0 {
+			limit = shift.Limit
+		}
+
+		for _, shiftBreak := range shift.Breaks {
+			if !now.Before(shiftBreak.Start) && now.Before(shiftBreak.End) {
+				return AgentAway, limit
+			}
+		}
+
+		if !now.Before(shift.End.Add(-shift.StopAssigningBefore)) {
+			return AgentClosing, limit
+		}
+
+		return AgentOnline, limit
+	}
+
+	return AgentOffline, ss.BaseLimit
+}
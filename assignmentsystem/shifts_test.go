@@ -0,0 +1,162 @@
+package assignmentsystem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShiftScheduleStateAt(t *testing.T) {
+	day := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	schedule := shiftSchedule{
+		BaseLimit: 5,
+		Shifts: []Shift{
+			{
+				Start: day.Add(9 * time.Hour),
+				End:   day.Add(17 * time.Hour),
+				Breaks: []Break{
+					{Start: day.Add(12 * time.Hour), End: day.Add(12*time.Hour + 30*time.Minute)},
+				},
+				Limit:               8,
+				StopAssigningBefore: 15 * time.Minute,
+			},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		at             time.Time
+		expectedStatus AgentStatus
+		expectedLimit  int
+	}{
+		{
+			name:           "Before the shift the agent is offline with the base limit",
+			at:             day.Add(8 * time.Hour),
+			expectedStatus: AgentOffline,
+			expectedLimit:  5,
+		},
+		{
+			name:           "Shift start brings the agent online with the shift limit",
+			at:             day.Add(9 * time.Hour),
+			expectedStatus: AgentOnline,
+			expectedLimit:  8,
+		},
+		{
+			name:           "Break sets the agent away",
+			at:             day.Add(12*time.Hour + 10*time.Minute),
+			expectedStatus: AgentAway,
+			expectedLimit:  8,
+		},
+		{
+			name:           "Back online once the break ends",
+			at:             day.Add(12*time.Hour + 30*time.Minute),
+			expectedStatus: AgentOnline,
+			expectedLimit:  8,
+		},
+		{
+			name:           "Stops taking work shortly before the shift ends",
+			at:             day.Add(16*time.Hour + 50*time.Minute),
+			expectedStatus: AgentClosing,
+			expectedLimit:  8,
+		},
+		{
+			name:           "Offline with the base limit restored after the shift",
+			at:             day.Add(17 * time.Hour),
+			expectedStatus: AgentOffline,
+			expectedLimit:  5,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, limit := schedule.stateAt(test.at)
+			assert.Equal(t, test.expectedStatus, status)
+			assert.Equal(t, test.expectedLimit, limit)
+		})
+	}
+}
+
+func TestIntegrationShiftsDriveAvailability(t *testing.T) {
+	now := time.Date(2025, 1, 6, 8, 0, 0, 0, time.UTC)
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2},
+		{Name: "agent2", Account: "account1", Limit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+
+	err := system.SetShifts("agent1", []Shift{
+		{Start: now.Add(time.Hour), End: now.Add(9 * time.Hour), Limit: 3},
+	})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, system.SetShifts("missing", nil), ErrUnknownAgent)
+
+	// Before the shift only the unscheduled agent takes work
+	system.ApplyShifts()
+	assignedAgents, err := system.Assign([]ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+		{ConversationID: "conv2", Account: "account1"},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"agent2"}, assignedAgents)
+
+	// During the shift agent1 is online with the shift limit
+	now = now.Add(time.Hour)
+	system.ApplyShifts()
+	assert.Equal(t, AgentOnline, system.agentAssignments["agent1"].Status)
+	assert.Equal(t, 3, system.agentAssignments["agent1"].Limit)
+
+	// After the shift the original limit comes back
+	now = now.Add(9 * time.Hour)
+	system.ApplyShifts()
+	assert.Equal(t, AgentOffline, system.agentAssignments["agent1"].Status)
+	assert.Equal(t, 2, system.agentAssignments["agent1"].Limit)
+
+	system.ClearShifts("agent1")
+	assert.Empty(t, system.agentShifts)
+}
+
+func TestIntegrationShiftsKeepManualOverrides(t *testing.T) {
+	now := time.Date(2025, 1, 6, 8, 0, 0, 0, time.UTC)
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2},
+	})
+	system.SetClock(func() time.Time { return now })
+
+	err := system.SetShifts("agent1", []Shift{{
+		Start:  now,
+		End:    now.Add(8 * time.Hour),
+		Breaks: []Break{{Start: now.Add(4 * time.Hour), End: now.Add(5 * time.Hour)}},
+		Limit:  3,
+	}})
+	assert.NoError(t, err)
+	system.ApplyShifts()
+
+	// A supervisor sends the agent away and lowers its limit mid-shift
+	assert.NoError(t, system.SetStatus("agent1", AgentAway))
+	system.SetLimit("agent1", 1)
+	now = now.Add(time.Hour)
+	system.ApplyShifts()
+	assert.Equal(t, AgentAway, system.agentAssignments["agent1"].Status)
+	assert.Equal(t, 1, system.agentAssignments["agent1"].Limit)
+
+	// The break starting is a boundary, the schedule takes over again
+	now = now.Add(3 * time.Hour)
+	system.ApplyShifts()
+	assert.Equal(t, AgentAway, system.agentAssignments["agent1"].Status)
+	assert.Equal(t, 3, system.agentAssignments["agent1"].Limit)
+
+	// And so is the break ending
+	assert.NoError(t, system.SetStatus("agent1", AgentOnline))
+	now = now.Add(time.Hour)
+	system.ApplyShifts()
+	assert.Equal(t, AgentOnline, system.agentAssignments["agent1"].Status)
+
+	// Loading a schedule again applies it on the next call
+	system.SetLimit("agent1", 1)
+	assert.NoError(t, system.SetShifts("agent1", system.agentShifts["agent1"].Shifts))
+	system.ApplyShifts()
+	assert.Equal(t, 3, system.agentAssignments["agent1"].Limit)
+}
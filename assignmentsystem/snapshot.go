@@ -0,0 +1,52 @@
+package assignmentsystem
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"time"
+)
+
+// snapshotRecord is one line of a snapshot, holding exactly one of its fields.
+// Agents and waiting conversations are written as Agent and Conversation
+// describe them, so the file doesn't depend on how the system keeps them.
+type snapshotRecord struct {
+	TakenAt *time.Time          `json:"taken_at,omitempty"`
+	Agent   *AgentDetail        `json:"agent,omitempty"`
+	Waiting *ConversationDetail `json:"waiting,omitempty"`
+}
+
+// WriteSnapshot writes the system's state to w as JSON lines: a header with
+// the time it was taken, then one line per agent in name order and one per
+// waiting conversation, in the same form as Agent and Conversation return
+// them. It streams rather than building the whole snapshot in memory so it
+// can be used with a full roster.
+func (as *AssignmentSystem) WriteSnapshot(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+
+	takenAt := as.clock()
+	if err := encoder.Encode(snapshotRecord{TakenAt: &takenAt}); err != nil {
+		return err
+	}
+
+	for _, agentName := range slices.Sorted(maps.Keys(as.agentAssignments)) {
+		agent := agentDetail(as.agentAssignments[agentName], takenAt)
+		if err := encoder.Encode(snapshotRecord{Agent: &agent}); err != nil {
+			return err
+		}
+	}
+
+	for _, account := range slices.Sorted(maps.Keys(as.waitingConversations)) {
+		for _, waiting := range as.waitingConversations[account] {
+			detail := waitingDetail(waiting)
+			if err := encoder.Encode(snapshotRecord{Waiting: &detail}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return buffered.Flush()
+}
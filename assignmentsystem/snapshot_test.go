@@ -0,0 +1,53 @@
+package assignmentsystem
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrationWriteSnapshot(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent2", Account: "account1", Limit: 1, Team: "tier1"},
+		{Name: "agent1", Account: "account2", Limit: 2},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetOverflowChain("account1", []OverflowTier{{Teams: []string{"tier1"}}})
+
+	_, err := system.Assign([]ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+		{ConversationID: "conv2", Account: "account1"},
+	})
+	assert.NoError(t, err)
+
+	var buffer bytes.Buffer
+	assert.NoError(t, system.WriteSnapshot(&buffer))
+	lines := bytes.Split(buffer.Bytes(), []byte("\n"))
+
+	records := make([]snapshotRecord, 0)
+	scanner := bufio.NewScanner(&buffer)
+	for scanner.Scan() {
+		var record snapshotRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+
+	assert.Len(t, records, 4)
+	assert.True(t, now.Equal(*records[0].TakenAt))
+	// Agents come out in name order
+	assert.Equal(t, "agent1", records[1].Agent.AgentName)
+	assert.Equal(t, "agent2", records[2].Agent.AgentName)
+	assert.Equal(t, []string{"conv1"}, records[2].Agent.Conversations)
+	assert.Equal(t, "conv2", records[3].Waiting.ConversationID)
+	assert.True(t, records[3].Waiting.Waiting)
+
+	// Only the public description of an agent is written, with its status by
+	// name
+	assert.Equal(t, `{"agent":{"agent_name":"agent1","accounts":["account2"],"status":"online","limit":2,"conversations":[],"wrap_up_slots":0,"free_slots":2}}`, string(lines[1]))
+}
@@ -0,0 +1,166 @@
+package assignmentsystem
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// TraceOp is the kind of a trace record
+type TraceOp string
+
+const (
+	// TraceAgent is one roster entry of the snapshot a trace starts with
+	TraceAgent TraceOp = "agent"
+	// TraceAssign is a batch of conversations given to Assign
+	TraceAssign TraceOp = "assign"
+	// TraceComplete is a call to Complete
+	TraceComplete TraceOp = "complete"
+	// TraceSetLimit is a call to SetLimit
+	TraceSetLimit TraceOp = "set_limit"
+	// TraceSetStatus is a call to SetStatus
+	TraceSetStatus TraceOp = "set_status"
+	// TraceReevaluate is a call to ReevaluateWaiting
+	TraceReevaluate TraceOp = "reevaluate"
+)
+
+// TraceRecord is one line of a trace. Which fields are set depends on Op, and
+// unset fields are left out. Keys are snake_case throughout, including those
+// of the roster entries and conversations it carries.
+type TraceRecord struct {
+	At             time.Time              `json:"at"`
+	Op             TraceOp                `json:"op"`
+	Agent          *AgentNameAndAccount   `json:"agent,omitempty"`
+	Conversations  []ConversationToAssign `json:"conversations,omitempty"`
+	ConversationID string                 `json:"conversation_id,omitempty"`
+	AgentName      string                 `json:"agent_name,omitempty"`
+	Limit          int                    `json:"limit,omitempty"`
+	Status         AgentStatus            `json:"status,omitempty"`
+}
+
+// Trace is a roster snapshot followed by the operations applied to it
+type Trace struct {
+	Roster     []AgentNameAndAccount
+	Operations []TraceRecord
+}
+
+// ReadTrace reads a trace written by StartTrace
+func ReadTrace(r io.Reader) (*Trace, error) {
+	trace := &Trace{}
+	decoder := json.NewDecoder(r)
+
+	for line := 1; ; line++ {
+		var record TraceRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return trace, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("trace record %d: %w", line, err)
+		}
+
+		switch record.Op {
+		case TraceAgent:
+			if record.Agent == nil {
+				return nil, fmt.Errorf("trace record %d: agent record without an agent", line)
+			}
+			trace.Roster = append(trace.Roster, *record.Agent)
+		case TraceAssign, TraceComplete, TraceSetLimit, TraceSetStatus, TraceReevaluate:
+			trace.Operations = append(trace.Operations, record)
+		default:
+			return nil, fmt.Errorf("trace record %d: unknown op %q", line, record.Op)
+		}
+	}
+}
+
+// traceRecorder writes the operations applied to an AssignmentSystem as JSON
+// lines
+type traceRecorder struct {
+	mu       sync.Mutex
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+	err      error
+}
+
+func (tr *traceRecorder) record(record TraceRecord) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	// The first error sticks and is reported by StopTrace
+	if tr.err == nil {
+		tr.err = tr.encoder.Encode(record)
+	}
+}
+
+// StartTrace starts writing a trace to w. It begins with a snapshot of the
+// roster, including agents that are not online, followed by every Assign,
+// Complete, SetLimit, SetStatus and ReevaluateWaiting call. Conversations
+// already in progress or waiting are not part of the snapshot, and neither is
+// the configuration: overflow chains, business hours, selection modes,
+// wrap-up, batch matching, shadows and experiments. Only one trace can be
+// recorded at a time.
+func (as *AssignmentSystem) StartTrace(w io.Writer) error {
+	if as.trace != nil {
+		return fmt.Errorf("a trace is already being recorded")
+	}
+
+	buffered := bufio.NewWriter(w)
+	recorder := &traceRecorder{buffered: buffered, encoder: json.NewEncoder(buffered)}
+	now := as.clock()
+
+	// Agents are listed per account in the order the account holds them, which
+	// is the order ties are broken in
+	for _, account := range slices.Sorted(maps.Keys(as.accountAgents)) {
+		for _, agentName := range as.accountAgents[account] {
+			wq := as.agentAssignments[agentName]
+			recorder.record(TraceRecord{At: now, Op: TraceAgent, Agent: &AgentNameAndAccount{
+				Name:         agentName,
+				Account:      account,
+				Limit:        wq.Limit,
+				Team:         wq.Team,
+				AccountLimit: wq.AccountLimits[account],
+			}})
+		}
+	}
+
+	for _, agentName := range slices.Sorted(maps.Keys(as.agentAssignments)) {
+		if status := as.agentAssignments[agentName].Status; status != AgentOnline {
+			recorder.record(TraceRecord{At: now, Op: TraceSetStatus, AgentName: agentName, Status: status})
+		}
+	}
+
+	as.trace = recorder
+	return recorder.err
+}
+
+// StopTrace stops recording and flushes the trace, returning the first error
+// hit while writing it
+func (as *AssignmentSystem) StopTrace() error {
+	recorder := as.trace
+	if recorder == nil {
+		return nil
+	}
+	as.trace = nil
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if recorder.err != nil {
+		return recorder.err
+	}
+	return recorder.buffered.Flush()
+}
+
+// traceOp records an operation if a trace is being recorded
+func (as *AssignmentSystem) traceOp(record TraceRecord) {
+	if as.trace == nil {
+		return
+	}
+
+	record.At = as.clock()
+	as.trace.record(record)
+}
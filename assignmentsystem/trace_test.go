@@ -0,0 +1,127 @@
+package assignmentsystem
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrationRecordTrace(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2, Team: "tier1"},
+		{Name: "agent2", Account: "account1", Limit: 1},
+		{Name: "agent1", Account: "account2", AccountLimit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+	assert.NoError(t, system.SetStatus("agent2", AgentAway))
+
+	var buffer bytes.Buffer
+	assert.NoError(t, system.StartTrace(&buffer))
+	assert.Error(t, system.StartTrace(&buffer))
+
+	now = now.Add(time.Minute)
+	_, err := system.Assign([]ConversationToAssign{{ConversationID: "conv1", Account: "account1"}})
+	assert.NoError(t, err)
+	now = now.Add(time.Minute)
+	assert.NoError(t, system.Complete("conv1"))
+	system.SetLimit("agent1", 3)
+	assert.NoError(t, system.SetStatus("agent2", AgentOnline))
+
+	assert.NoError(t, system.StopTrace())
+	// Nothing is recorded once stopped
+	system.SetLimit("agent1", 4)
+
+	// Every key is snake_case and unset fields are left out
+	lines := strings.Split(buffer.String(), "\n")
+	assert.Equal(t, `{"at":"2025-01-06T09:00:00Z","op":"agent","agent":{"name":"agent1","account":"account2","limit":2,"team":"tier1","account_limit":1}}`, lines[2])
+	assert.Equal(t, `{"at":"2025-01-06T09:01:00Z","op":"assign","conversations":[{"conversation_id":"conv1","account":"account1"}]}`, lines[4])
+
+	trace, err := ReadTrace(&buffer)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2, Team: "tier1"},
+		{Name: "agent2", Account: "account1", Limit: 1},
+		{Name: "agent1", Account: "account2", Limit: 2, Team: "tier1", AccountLimit: 1},
+	}, trace.Roster)
+
+	assert.Len(t, trace.Operations, 5)
+	// The snapshot carries statuses other than online
+	assert.Equal(t, TraceSetStatus, trace.Operations[0].Op)
+	assert.Equal(t, AgentAway, trace.Operations[0].Status)
+	assert.Equal(t, TraceAssign, trace.Operations[1].Op)
+	assert.Equal(t, []ConversationToAssign{{ConversationID: "conv1", Account: "account1"}}, trace.Operations[1].Conversations)
+	assert.True(t, now.Add(-time.Minute).Equal(trace.Operations[1].At))
+	assert.Equal(t, TraceComplete, trace.Operations[2].Op)
+	assert.Equal(t, "conv1", trace.Operations[2].ConversationID)
+	assert.Equal(t, TraceSetLimit, trace.Operations[3].Op)
+	assert.Equal(t, 3, trace.Operations[3].Limit)
+	assert.Equal(t, TraceSetStatus, trace.Operations[4].Op)
+	assert.Equal(t, AgentOnline, trace.Operations[4].Status)
+}
+
+func TestIntegrationTraceShifts(t *testing.T) {
+	now := time.Date(2025, 1, 6, 8, 0, 0, 0, time.UTC)
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2},
+		{Name: "agent2", Account: "account1", Limit: 2},
+	})
+	system.SetClock(func() time.Time { return now })
+	assert.NoError(t, system.SetShifts("agent1", []Shift{{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour), Limit: 3}}))
+	assert.NoError(t, system.SetShifts("agent2", []Shift{{Start: now, End: now.Add(2 * time.Hour)}}))
+
+	var buffer bytes.Buffer
+	assert.NoError(t, system.StartTrace(&buffer))
+	for range 3 {
+		system.ApplyShifts()
+		now = now.Add(time.Hour)
+	}
+	assert.NoError(t, system.StopTrace())
+
+	trace, err := ReadTrace(&buffer)
+	assert.NoError(t, err)
+
+	type change struct {
+		Op        TraceOp
+		AgentName string
+		Status    AgentStatus
+		Limit     int
+	}
+	changes := make([]change, 0)
+	for _, operation := range trace.Operations {
+		changes = append(changes, change{operation.Op, operation.AgentName, operation.Status, operation.Limit})
+	}
+	// Only what changed is recorded, agent2's limit never does
+	assert.Equal(t, []change{
+		{TraceSetStatus, "agent1", AgentOffline, 0},
+		{TraceSetStatus, "agent1", AgentOnline, 0},
+		{TraceSetLimit, "agent1", 0, 3},
+		{TraceSetStatus, "agent1", AgentOffline, 0},
+		{TraceSetLimit, "agent1", 0, 2},
+		{TraceSetStatus, "agent2", AgentOffline, 0},
+	}, changes)
+}
+
+func TestReadTraceErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "Invalid JSON", input: `{"op":`},
+		{name: "Unknown op", input: `{"at":"2025-01-06T09:00:00Z","op":"teleport"}`},
+		{name: "Agent record without an agent", input: `{"at":"2025-01-06T09:00:00Z","op":"agent"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadTrace(strings.NewReader(test.input))
+			assert.Error(t, err)
+		})
+	}
+}
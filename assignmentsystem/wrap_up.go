@@ -0,0 +1,69 @@
+package assignmentsystem
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// SetWrapUpDuration configures how long an agent's slot stays held for
+// after-call work once a conversation for the account ends. Zero frees the
+// slot immediately.
+func (as *AssignmentSystem) SetWrapUpDuration(account string, duration time.Duration) {
+	if as.wrapUpDurations == nil {
+		as.wrapUpDurations = make(map[string]time.Duration)
+	}
+
+	if duration <= 0 {
+		delete(as.wrapUpDurations, account)
+		return
+	}
+	as.wrapUpDurations[account] = duration
+}
+
+// ExtendWrapUp gives the agent more time on their latest wrap-up
+func (as *AssignmentSystem) ExtendWrapUp(agentName string, extension time.Duration) error {
+	wq, ok := as.agentAssignments[agentName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAgent, agentName)
+	}
+
+	wq.pruneWrapUps(as.clock())
+	if len(wq.WrapUpUntil) == 0 {
+		return fmt.Errorf("agent %s is not in wrap-up", agentName)
+	}
+
+	// Wrap-ups are kept in the order they end, so the latest one is last
+	wq.WrapUpUntil[len(wq.WrapUpUntil)-1] = wq.WrapUpUntil[len(wq.WrapUpUntil)-1].Add(extension)
+	return nil
+}
+
+func (as *AssignmentSystem) startWrapUp(wq *AgentWorkQueue, account string) {
+	duration, ok := as.wrapUpDurations[account]
+	if !ok {
+		return
+	}
+
+	now := as.clock()
+	wq.pruneWrapUps(now)
+	wq.WrapUpUntil = append(wq.WrapUpUntil, now.Add(duration))
+	slices.SortFunc(wq.WrapUpUntil, func(a, b time.Time) int { return a.Compare(b) })
+}
+
+// slotsInWrapUp counts the slots still held for after-call work at the given time
+func (wq *AgentWorkQueue) slotsInWrapUp(now time.Time) int {
+	held := 0
+	for _, until := range wq.WrapUpUntil {
+		if until.After(now) {
+			held++
+		}
+	}
+
+	return held
+}
+
+func (wq *AgentWorkQueue) pruneWrapUps(now time.Time) {
+	wq.WrapUpUntil = slices.DeleteFunc(wq.WrapUpUntil, func(until time.Time) bool {
+		return !until.After(now)
+	})
+}
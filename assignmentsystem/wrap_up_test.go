@@ -0,0 +1,133 @@
+package assignmentsystem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlotsInWrapUp(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		input       []time.Time
+		expectation int
+	}{
+		{
+			name:        "No wrap-ups",
+			input:       nil,
+			expectation: 0,
+		},
+		{
+			name:        "Wrap-ups still running are held",
+			input:       []time.Time{now.Add(time.Minute), now.Add(2 * time.Minute)},
+			expectation: 2,
+		},
+		{
+			name:        "Expired wrap-ups are released",
+			input:       []time.Time{now.Add(-time.Minute), now, now.Add(time.Minute)},
+			expectation: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wq := &AgentWorkQueue{WrapUpUntil: test.input}
+			assert.Equal(t, test.expectation, wq.slotsInWrapUp(now))
+		})
+	}
+}
+
+func TestIntegrationWrapUpHoldsSlot(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetWrapUpDuration("account1", 2*time.Minute)
+
+	assignedAgents, err := system.Assign([]ConversationToAssign{{ConversationID: "conv1", Account: "account1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent1"}, assignedAgents)
+
+	assert.NoError(t, system.Complete("conv1"))
+	assert.Empty(t, system.agentAssignments["agent1"].Queue)
+
+	// The slot is still held for after-call work
+	_, err = system.Assign([]ConversationToAssign{{ConversationID: "conv2", Account: "account1"}})
+	assert.Error(t, err)
+
+	// The agent asks for more time
+	now = now.Add(time.Minute)
+	assert.NoError(t, system.ExtendWrapUp("agent1", 2*time.Minute))
+
+	now = now.Add(time.Minute + 30*time.Second)
+	_, err = system.Assign([]ConversationToAssign{{ConversationID: "conv3", Account: "account1"}})
+	assert.Error(t, err)
+
+	// Released once the extended wrap-up is over
+	now = now.Add(90 * time.Second)
+	assignedAgents, err = system.Assign([]ConversationToAssign{{ConversationID: "conv4", Account: "account1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent1"}, assignedAgents)
+}
+
+func TestIntegrationWrapUpCountsAsLoad(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 3},
+		{Name: "agent2", Account: "account1", Limit: 3},
+	})
+	system.SetClock(func() time.Time { return now })
+	system.SetWrapUpDuration("account1", 2*time.Minute)
+
+	// agent1 wraps up two conversations while agent2 takes one
+	assert.NoError(t, system.SetStatus("agent2", AgentAway))
+	_, err := system.Assign([]ConversationToAssign{
+		{ConversationID: "conv1", Account: "account1"},
+		{ConversationID: "conv2", Account: "account1"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, system.Complete("conv1"))
+	assert.NoError(t, system.Complete("conv2"))
+	assert.NoError(t, system.SetStatus("agent2", AgentOnline))
+	assignedAgents, err := system.Assign([]ConversationToAssign{{ConversationID: "conv3", Account: "account1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent2"}, assignedAgents)
+
+	// agent1 has one free slot against agent2's two
+	conversation := ConversationToAssign{ConversationID: "conv4", Account: "account1"}
+	explanation, err := system.Explain(conversation)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent2", explanation.AgentName)
+	assert.Equal(t, CriterionLeastLoad, explanation.Criterion)
+	assert.Equal(t, "the only agent with as few as 1 conversations", explanation.Candidates[0].Reason)
+	assert.Equal(t, "more work than agent2 (0 conversations and 2 slots held for wrap-up against 1 conversations)", explanation.Candidates[1].Reason)
+	assert.Equal(t, 2, explanation.Candidates[1].WrapUpSlots)
+
+	assignedAgents, err = system.Assign([]ConversationToAssign{conversation})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent2"}, assignedAgents)
+}
+
+func TestIntegrationWrapUpErrors(t *testing.T) {
+	system := NewAssignmentSystem([]AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+	})
+
+	assert.ErrorIs(t, system.Complete("missing"), ErrUnknownConversation)
+	assert.ErrorIs(t, system.ExtendWrapUp("missing", time.Minute), ErrUnknownAgent)
+	assert.Error(t, system.ExtendWrapUp("agent1", time.Minute))
+
+	// Without a wrap-up duration the slot is freed straight away
+	_, err := system.Assign([]ConversationToAssign{{ConversationID: "conv1", Account: "account1"}})
+	assert.NoError(t, err)
+	assert.NoError(t, system.Complete("conv1"))
+	assignedAgents, err := system.Assign([]ConversationToAssign{{ConversationID: "conv2", Account: "account1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent1"}, assignedAgents)
+}
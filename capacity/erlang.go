@@ -0,0 +1,205 @@
+// Package capacity works out how many agents an account needs to meet a
+// service level, using the Erlang C queueing model
+package capacity
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Forecast is the demand expected on an account
+type Forecast struct {
+	Account         string  `json:"account"`
+	ArrivalsPerHour float64 `json:"arrivals_per_hour"`
+
+	// Mean time to handle a conversation when it is the agent's only one
+	MeanHandleSeconds float64 `json:"mean_handle_seconds"`
+	// How much longer each conversation takes for every other conversation
+	// handled alongside it. With 0.2 an agent handling three at once takes
+	// 40% longer on each. Zero treats concurrent conversations as independent.
+	ConcurrencyPenalty float64 `json:"concurrency_penalty"`
+}
+
+// Validate reports forecasts that can't be planned for
+func (f Forecast) Validate() error {
+	switch {
+	case f.ArrivalsPerHour < 0:
+		return fmt.Errorf("%s: arrivals per hour must not be negative, got %v", f.Account, f.ArrivalsPerHour)
+	case f.MeanHandleSeconds <= 0:
+		return fmt.Errorf("%s: mean handle time must be positive, got %v", f.Account, f.MeanHandleSeconds)
+	case f.ConcurrencyPenalty < 0:
+		return fmt.Errorf("%s: concurrency penalty must not be negative, got %v", f.Account, f.ConcurrencyPenalty)
+	}
+
+	return nil
+}
+
+// handleSeconds is the mean handle time of a conversation for agents working
+// up to limit conversations at once
+func (f Forecast) handleSeconds(limit int) float64 {
+	return f.MeanHandleSeconds * (1 + f.ConcurrencyPenalty*float64(limit-1))
+}
+
+// ServiceLevel is the share of conversations that should be assigned to an
+// agent within a given time of arriving, e.g. 80% within 20 seconds
+type ServiceLevel struct {
+	Target float64       `json:"target"`
+	Within time.Duration `json:"within_ns"`
+}
+
+// Validate reports service levels that can't be met
+func (sl ServiceLevel) Validate() error {
+	switch {
+	case sl.Target <= 0 || sl.Target >= 1:
+		return fmt.Errorf("service level target must be between 0 and 1, got %v", sl.Target)
+	case sl.Within < 0:
+		return fmt.Errorf("service level time must not be negative, got %v", sl.Within)
+	}
+
+	return nil
+}
+
+// Recommendation is a staffing level for an account and how it is predicted
+// to perform
+type Recommendation struct {
+	Account string       `json:"account"`
+	Target  ServiceLevel `json:"target"`
+	Agents  int          `json:"agents"`
+	Limit   int          `json:"limit"`
+
+	HandleSeconds float64 `json:"handle_seconds"` // Mean handle time at this limit
+	OfferedLoad   float64 `json:"offered_load"`   // Conversations in progress at once on average, in erlangs
+
+	// Predicted by Erlang C
+	ProbabilityOfWaiting float64       `json:"probability_of_waiting"`
+	ServiceLevel         float64       `json:"service_level"`
+	AverageWait          time.Duration `json:"average_wait_ns"`
+	Occupancy            float64       `json:"occupancy"` // Share of the agents' slots in use
+}
+
+// ErlangC is the probability that a conversation has to wait when the offered
+// load, in erlangs, is served by the given number of slots. It is 1 when the
+// slots can't keep up with the load.
+func ErlangC(servers int, offeredLoad float64) float64 {
+	if offeredLoad <= 0 {
+		return 0
+	}
+	if float64(servers) <= offeredLoad {
+		return 1
+	}
+
+	return erlangCFromB(servers, offeredLoad, erlangB(servers, offeredLoad))
+}
+
+// erlangB is the blocking probability of the load on the servers, computed
+// with the recurrence that stays stable for thousands of servers
+func erlangB(servers int, offeredLoad float64) float64 {
+	b := 1.0
+	for n := 1; n <= servers; n++ {
+		b = offeredLoad * b / (float64(n) + offeredLoad*b)
+	}
+	return b
+}
+
+func erlangCFromB(servers int, offeredLoad float64, b float64) float64 {
+	n := float64(servers)
+	return n * b / (n - offeredLoad*(1-b))
+}
+
+// Predict works out how an account staffed by the given number of agents, each
+// taking up to limit conversations at once, performs against the target. Every
+// agent counts as limit slots, with the forecast's handle time stretched by
+// the concurrency penalty. A limit of 1 is classic Erlang C.
+func Predict(forecast Forecast, target ServiceLevel, agents int, limit int) (Recommendation, error) {
+	if err := validate(forecast, target, limit); err != nil {
+		return Recommendation{}, err
+	}
+	if agents < 0 {
+		return Recommendation{}, fmt.Errorf("%s: agents must not be negative, got %d", forecast.Account, agents)
+	}
+
+	recommendation := Recommendation{
+		Account:       forecast.Account,
+		Target:        target,
+		Agents:        agents,
+		Limit:         limit,
+		HandleSeconds: forecast.handleSeconds(limit),
+	}
+	recommendation.OfferedLoad = forecast.ArrivalsPerHour / 3600 * recommendation.HandleSeconds
+
+	servers := agents * limit
+	if recommendation.OfferedLoad == 0 {
+		recommendation.ServiceLevel = 1
+		return recommendation, nil
+	}
+	if float64(servers) <= recommendation.OfferedLoad {
+		// The queue grows without bound
+		recommendation.ProbabilityOfWaiting = 1
+		recommendation.Occupancy = 1
+		return recommendation, nil
+	}
+
+	c := ErlangC(servers, recommendation.OfferedLoad)
+	recommendation.ProbabilityOfWaiting = c
+	recommendation.ServiceLevel = serviceLevel(c, servers, recommendation.OfferedLoad, recommendation.HandleSeconds, target.Within)
+	recommendation.AverageWait = time.Duration(c * recommendation.HandleSeconds / (float64(servers) - recommendation.OfferedLoad) * float64(time.Second))
+	recommendation.Occupancy = recommendation.OfferedLoad / float64(servers)
+
+	return recommendation, nil
+}
+
+// serviceLevel is the share of conversations assigned within the given time
+func serviceLevel(c float64, servers int, offeredLoad float64, handleSeconds float64, within time.Duration) float64 {
+	return 1 - c*math.Exp(-(float64(servers)-offeredLoad)*within.Seconds()/handleSeconds)
+}
+
+// Recommend finds the fewest agents taking up to limit conversations at once
+// that meet the target for the forecast
+func Recommend(forecast Forecast, target ServiceLevel, limit int) (Recommendation, error) {
+	if err := validate(forecast, target, limit); err != nil {
+		return Recommendation{}, err
+	}
+
+	handleSeconds := forecast.handleSeconds(limit)
+	offeredLoad := forecast.ArrivalsPerHour / 3600 * handleSeconds
+	if offeredLoad == 0 {
+		return Predict(forecast, target, 0, limit)
+	}
+
+	// Add slots one at a time, carrying the Erlang B recurrence along, until
+	// the service level is met. It always is eventually as the chance of
+	// waiting falls towards zero.
+	b := 1.0
+	servers := 0
+	for {
+		servers++
+		b = offeredLoad * b / (float64(servers) + offeredLoad*b)
+		if float64(servers) <= offeredLoad {
+			continue
+		}
+
+		c := erlangCFromB(servers, offeredLoad, b)
+		if serviceLevel(c, servers, offeredLoad, handleSeconds, target.Within) >= target.Target {
+			break
+		}
+	}
+
+	// Agents come whole, round the slots up
+	agents := (servers + limit - 1) / limit
+	return Predict(forecast, target, agents, limit)
+}
+
+func validate(forecast Forecast, target ServiceLevel, limit int) error {
+	if err := forecast.Validate(); err != nil {
+		return err
+	}
+	if err := target.Validate(); err != nil {
+		return err
+	}
+	if limit < 1 {
+		return fmt.Errorf("limit must be at least 1, got %d", limit)
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package capacity
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestErlangC(t *testing.T) {
+	tests := []struct {
+		name        string
+		servers     int
+		offeredLoad float64
+		expected    float64
+	}{
+		{name: "No load", servers: 3, offeredLoad: 0, expected: 0},
+		{name: "Single server waits as often as it is busy", servers: 1, offeredLoad: 0.5, expected: 0.5},
+		{name: "Textbook example", servers: 12, offeredLoad: 10, expected: 0.4494},
+		{name: "Overloaded", servers: 10, offeredLoad: 10, expected: 1},
+		{name: "Thousands of servers stay stable", servers: 10100, offeredLoad: 10000, expected: 0.2248},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if c := ErlangC(test.servers, test.offeredLoad); math.Abs(c-test.expected) > 1e-3 {
+				t.Errorf("Expected %v, got %v", test.expected, c)
+			}
+		})
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	forecast := Forecast{Account: "account1", ArrivalsPerHour: 360, MeanHandleSeconds: 180}
+	target := ServiceLevel{Target: 0.8, Within: 20 * time.Second}
+
+	recommendation, err := Recommend(forecast, target, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if recommendation.Agents != 22 || recommendation.OfferedLoad != 18 || recommendation.ServiceLevel < 0.8 {
+		t.Errorf("Expected 22 agents for 18 erlangs, got %+v", recommendation)
+	}
+
+	// One agent fewer falls short
+	fewer, err := Predict(forecast, target, recommendation.Agents-1, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if fewer.ServiceLevel >= 0.8 {
+		t.Errorf("Expected %d agents to miss the target, got %+v", fewer.Agents, fewer)
+	}
+
+	// Handling three at once needs fewer agents, unless it slows them down
+	concurrent, err := Recommend(forecast, target, 3)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if concurrent.Agents != 8 || concurrent.Occupancy != 0.75 {
+		t.Errorf("Expected 8 agents taking 3 conversations each, got %+v", concurrent)
+	}
+
+	forecast.ConcurrencyPenalty = 0.2
+	slowed, err := Recommend(forecast, target, 3)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if math.Abs(slowed.HandleSeconds-252) > 1e-9 || slowed.Agents <= concurrent.Agents {
+		t.Errorf("Expected longer handle times to need more agents, got %+v", slowed)
+	}
+}
+
+func TestPredictEdgeCases(t *testing.T) {
+	target := ServiceLevel{Target: 0.8, Within: 20 * time.Second}
+
+	idle, err := Recommend(Forecast{Account: "quiet", MeanHandleSeconds: 60}, target, 2)
+	if err != nil || idle.Agents != 0 || idle.ServiceLevel != 1 {
+		t.Errorf("Expected no agents for no traffic, got %+v, %v", idle, err)
+	}
+
+	overloaded, err := Predict(Forecast{Account: "busy", ArrivalsPerHour: 3600, MeanHandleSeconds: 60}, target, 30, 1)
+	if err != nil || overloaded.ProbabilityOfWaiting != 1 || overloaded.ServiceLevel != 0 {
+		t.Errorf("Expected an overloaded account to miss the target entirely, got %+v, %v", overloaded, err)
+	}
+}
+
+func TestRecommendValidation(t *testing.T) {
+	forecast := Forecast{Account: "account1", ArrivalsPerHour: 100, MeanHandleSeconds: 60}
+	target := ServiceLevel{Target: 0.8, Within: 20 * time.Second}
+
+	tests := []struct {
+		name     string
+		forecast Forecast
+		target   ServiceLevel
+		limit    int
+	}{
+		{name: "Negative arrivals", forecast: Forecast{ArrivalsPerHour: -1, MeanHandleSeconds: 60}, target: target, limit: 1},
+		{name: "No handle time", forecast: Forecast{ArrivalsPerHour: 100}, target: target, limit: 1},
+		{name: "Negative penalty", forecast: Forecast{ArrivalsPerHour: 100, MeanHandleSeconds: 60, ConcurrencyPenalty: -0.1}, target: target, limit: 1},
+		{name: "Target of 100%", forecast: forecast, target: ServiceLevel{Target: 1, Within: time.Second}, limit: 1},
+		{name: "Zero limit", forecast: forecast, target: target, limit: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Recommend(test.forecast, test.target, test.limit); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package capacity
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+	"github.com/flygerian/assignment-system/loadtest"
+)
+
+// Validation is how an account staffed to a recommendation performed in a
+// simulation, to check the model against the assignment system itself
+type Validation struct {
+	// Conversations that arrived after the warmup. Those still waiting at the
+	// end for less than the target time are left out, as it isn't known yet
+	// whether they make it.
+	Arrivals        int           `json:"arrivals"`
+	Failed          int           `json:"failed"`
+	ServiceLevel    float64       `json:"service_level"`
+	AverageWait     time.Duration `json:"average_wait_ns"`
+	MeanUtilisation float64       `json:"mean_utilisation"`
+}
+
+// Validate simulates the account staffed as recommended on a virtual clock.
+// Conversations arrive one second at a time as a Poisson process at the
+// forecast rate, are handled for exponentially distributed times and wait for
+// an agent when none is free, which is what Erlang C assumes. Agents stay
+// logged in throughout.
+func Validate(ctx context.Context, forecast Forecast, recommendation Recommendation, duration time.Duration, warmup time.Duration, seed int64) (Validation, error) {
+	if duration < time.Second {
+		return Validation{}, fmt.Errorf("duration must be at least a second, got %v", duration)
+	}
+	if warmup < 0 || warmup >= duration {
+		return Validation{}, fmt.Errorf("warmup must be shorter than the duration, got %v", warmup)
+	}
+
+	roster := loadtest.GenerateAccountAgents(forecast.Account, recommendation.Agents, recommendation.Limit)
+	system := assignmentsystem.NewAssignmentSystem(roster)
+	// Conversations wait for any agent of the account instead of failing
+	system.SetOverflowChain(forecast.Account, []assignmentsystem.OverflowTier{{}})
+
+	random := loadtest.NewRand(seed)
+	seconds := int(duration / time.Second)
+	traffic := poissonTraffic(forecast, seconds, random)
+
+	options := loadtest.SimulationOptions{
+		HandleTime:        loadtest.ExponentialHandleTime,
+		MeanHandleSeconds: recommendation.HandleSeconds,
+		WarmupSeconds:     warmup.Seconds(),
+	}
+	start := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	simulator, err := loadtest.NewSimulator(&system, roster, options, start, random)
+	if err != nil {
+		return Validation{}, err
+	}
+
+	measuredFrom := start.Add(warmup)
+	pending := make(map[string]time.Time) // Waiting conversations that arrived after the warmup
+	var validation Validation
+	within, served := 0, 0
+	var totalWait time.Duration
+
+	err = simulator.RunVirtual(ctx, traffic, time.Second, func(step loadtest.SimulationStep) {
+		for _, dequeued := range step.Dequeued {
+			if _, ok := pending[dequeued.ConversationID]; !ok {
+				continue // Arrived during the warmup
+			}
+			delete(pending, dequeued.ConversationID)
+			served++
+			totalWait += dequeued.Waited
+			if dequeued.Waited <= recommendation.Target.Within {
+				within++
+			}
+		}
+
+		if step.At.Before(measuredFrom) {
+			return
+		}
+		for _, result := range step.Batch.Results {
+			validation.Arrivals++
+			switch {
+			case result.Err != nil:
+				validation.Failed++
+			case result.Waiting:
+				pending[result.ConversationID] = step.At
+			default:
+				served++
+				within++
+			}
+		}
+	})
+	if err != nil {
+		return Validation{}, err
+	}
+
+	end := start.Add(time.Duration(seconds) * time.Second)
+	for _, arrived := range pending {
+		// Still waiting, and not yet past the target
+		if end.Sub(arrived) <= recommendation.Target.Within {
+			validation.Arrivals--
+		}
+	}
+
+	if validation.Arrivals > 0 {
+		validation.ServiceLevel = float64(within) / float64(validation.Arrivals)
+	}
+	if served > 0 {
+		validation.AverageWait = totalWait / time.Duration(served)
+	}
+	validation.MeanUtilisation = simulator.Report().MeanUtilisation
+
+	return validation, nil
+}
+
+// poissonTraffic draws the conversations arriving in each second at the
+// forecast's rate
+func poissonTraffic(forecast Forecast, seconds int, random *rand.Rand) [][]assignmentsystem.ConversationToAssign {
+	traffic := make([][]assignmentsystem.ConversationToAssign, seconds)
+	perSecond := forecast.ArrivalsPerHour / 3600
+	conversationID := 1
+
+	for second := range traffic {
+		arrivals := samplePoisson(perSecond, random)
+		traffic[second] = make([]assignmentsystem.ConversationToAssign, arrivals)
+		for i := range arrivals {
+			traffic[second][i] = assignmentsystem.ConversationToAssign{
+				ConversationID: fmt.Sprintf("conversation-%d", conversationID),
+				Account:        forecast.Account,
+			}
+			conversationID++
+		}
+	}
+
+	return traffic
+}
+
+// samplePoisson draws from a Poisson distribution with the given mean, using
+// the normal approximation once the mean is large enough for it to hold
+func samplePoisson(mean float64, random *rand.Rand) int {
+	if mean > 30 {
+		return max(0, int(math.Round(mean+math.Sqrt(mean)*random.NormFloat64())))
+	}
+
+	threshold := math.Exp(-mean)
+	arrivals := 0
+	for product := random.Float64(); product > threshold; product *= random.Float64() {
+		arrivals++
+	}
+	return arrivals
+}
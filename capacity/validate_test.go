@@ -0,0 +1,77 @@
+package capacity
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// Queues are slow to settle, it takes a couple of simulated days for the
+// measured service level to come close to the model's
+func TestValidateAgreesWithTheModel(t *testing.T) {
+	target := ServiceLevel{Target: 0.8, Within: 20 * time.Second}
+	tests := []struct {
+		name     string
+		forecast Forecast
+		limit    int
+	}{
+		{name: "One conversation at a time", forecast: Forecast{Account: "voice", ArrivalsPerHour: 720, MeanHandleSeconds: 120}, limit: 1},
+		{name: "Chat", forecast: Forecast{Account: "chat", ArrivalsPerHour: 720, MeanHandleSeconds: 120, ConcurrencyPenalty: 0.1}, limit: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recommendation, err := Recommend(test.forecast, target, test.limit)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			validation, err := Validate(context.Background(), test.forecast, recommendation, 48*time.Hour, 15*time.Minute, 1)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if validation.Failed != 0 || validation.Arrivals < 30000 {
+				t.Errorf("Expected every conversation to wait rather than fail, got %+v", validation)
+			}
+			if math.Abs(validation.ServiceLevel-recommendation.ServiceLevel) > 0.05 {
+				t.Errorf("Expected a service level close to the predicted %.3f, got %.3f", recommendation.ServiceLevel, validation.ServiceLevel)
+			}
+			if math.Abs(validation.MeanUtilisation-recommendation.Occupancy) > 0.05 {
+				t.Errorf("Expected utilisation close to the predicted %.3f, got %.3f", recommendation.Occupancy, validation.MeanUtilisation)
+			}
+		})
+	}
+}
+
+func TestValidateUnderstaffed(t *testing.T) {
+	forecast := Forecast{Account: "account1", ArrivalsPerHour: 720, MeanHandleSeconds: 120}
+	target := ServiceLevel{Target: 0.8, Within: 20 * time.Second}
+
+	// 24 erlangs on 24 agents never catches up
+	understaffed, err := Predict(forecast, target, 24, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	validation, err := Validate(context.Background(), forecast, understaffed, 2*time.Hour, 0, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if validation.ServiceLevel > 0.5 || validation.AverageWait < time.Minute {
+		t.Errorf("Expected long waits, got %+v", validation)
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	forecast := Forecast{Account: "account1", ArrivalsPerHour: 100, MeanHandleSeconds: 60}
+	recommendation := Recommendation{Account: "account1", Agents: 5, Limit: 1, HandleSeconds: 60}
+
+	if _, err := Validate(context.Background(), forecast, recommendation, 0, 0, 1); err == nil {
+		t.Errorf("Expected an error for no duration")
+	}
+	if _, err := Validate(context.Background(), forecast, recommendation, time.Hour, time.Hour, 1); err == nil {
+		t.Errorf("Expected an error for a warmup as long as the run")
+	}
+}
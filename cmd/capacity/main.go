@@ -0,0 +1,141 @@
+// Command capacity recommends how many agents each account needs to meet a
+// service level, given forecasted arrivals and handle times
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flygerian/assignment-system/capacity"
+)
+
+// plan is the recommendation for one account at one limit, with its
+// simulated validation if one was asked for
+type plan struct {
+	capacity.Recommendation
+	Validation *capacity.Validation `json:"validation,omitempty"`
+}
+
+func main() {
+	flags := flag.NewFlagSet("capacity", flag.ContinueOnError)
+	forecastPath := flags.String("forecast", "", "JSON file with a list of forecasts: account, arrivals_per_hour, mean_handle_seconds and concurrency_penalty")
+	target := flags.Float64("target", 0.8, "share of conversations to assign within the service level time")
+	within := flags.Duration("within", 20*time.Second, "service level time")
+	minLimit := flags.Int("min-limit", 1, "lowest agent limit to plan for")
+	maxLimit := flags.Int("max-limit", 1, "highest agent limit to plan for")
+	validate := flags.Duration("validate", 0, "simulated time to check each recommendation for, 0 to skip")
+	warmup := flags.Duration("warmup", 15*time.Minute, "simulated time left out of a validation while queues build up")
+	seed := flags.Int64("seed", 1, "random seed for validation")
+	reportPath := flags.String("report-json", "", "file to write the recommendations to as JSON")
+
+	err := flags.Parse(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *forecastPath == "" {
+		log.Fatal("-forecast is required")
+	}
+	if *minLimit < 1 || *maxLimit < *minLimit {
+		log.Fatalf("invalid limit range %d-%d", *minLimit, *maxLimit)
+	}
+
+	forecasts, err := readForecasts(*forecastPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serviceLevel := capacity.ServiceLevel{Target: *target, Within: *within}
+	var plans []plan
+	for _, forecast := range forecasts {
+		for limit := *minLimit; limit <= *maxLimit; limit++ {
+			recommendation, err := capacity.Recommend(forecast, serviceLevel, limit)
+			if err != nil {
+				log.Fatal(err)
+			}
+			p := plan{Recommendation: recommendation}
+
+			if *validate > 0 {
+				log.Printf("Validating %d agents at limit %d for %s", recommendation.Agents, limit, forecast.Account)
+				validation, err := capacity.Validate(ctx, forecast, recommendation, *validate, *warmup, *seed)
+				if err != nil {
+					log.Fatal(err)
+				}
+				p.Validation = &validation
+			}
+
+			plans = append(plans, p)
+		}
+	}
+
+	if err := writePlans(plans); err != nil {
+		log.Fatal(err)
+	}
+	if *reportPath != "" {
+		if err := writeReport(plans, *reportPath); err != nil {
+			log.Fatalf("Failed to write report to %s: %v", *reportPath, err)
+		}
+	}
+}
+
+func readForecasts(path string) ([]capacity.Forecast, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var forecasts []capacity.Forecast
+	if err := json.Unmarshal(data, &forecasts); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	return forecasts, nil
+}
+
+func writePlans(plans []plan) error {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintln(table, "account\tlimit\tagents\terlangs\toccupancy\tp(wait)\tservice level\tavg wait\tsimulated level\tsimulated wait\t")
+	for _, p := range plans {
+		simulatedLevel, simulatedWait := "-", "-"
+		if p.Validation != nil {
+			simulatedLevel = fmt.Sprintf("%.1f%%", 100*p.Validation.ServiceLevel)
+			simulatedWait = p.Validation.AverageWait.Round(100 * time.Millisecond).String()
+		}
+		fmt.Fprintf(table, "%s\t%d\t%d\t%.1f\t%.1f%%\t%.1f%%\t%.1f%%\t%v\t%s\t%s\t\n",
+			p.Account, p.Limit, p.Agents, p.OfferedLoad, 100*p.Occupancy, 100*p.ProbabilityOfWaiting,
+			100*p.ServiceLevel, p.AverageWait.Round(100*time.Millisecond), simulatedLevel, simulatedWait)
+	}
+
+	return table.Flush()
+}
+
+func writeReport(plans []plan, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(plans); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+	"github.com/flygerian/assignment-system/loadtest"
+)
+
+// runCompare runs the workload once per strategy, replaying the trace if there
+// is one and simulating the generated traffic on a virtual clock otherwise,
+// then prints the results side by side
+func runCompare(ctx context.Context, agents []assignmentsystem.AgentNameAndAccount, traffic [][]assignmentsystem.ConversationToAssign, trace *assignmentsystem.Trace, config runConfig) error {
+	strategies, err := loadtest.ParseStrategies(config.Strategies)
+	if err != nil {
+		return err
+	}
+
+	var results []loadtest.StrategyResult
+	if trace != nil {
+		log.Printf("Replaying %d operations once per strategy", len(trace.Operations))
+		results, err = loadtest.CompareReplayed(ctx, trace, strategies)
+	} else {
+		log.Printf("Simulating %v once per strategy", config.Duration)
+		results, err = loadtest.CompareSimulated(ctx, agents, traffic, config.Simulation, time.Now(), config.Seed, strategies)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := loadtest.WriteComparison(os.Stdout, results); err != nil {
+		return err
+	}
+	if config.ReportPath != "" {
+		return writeComparison(results, config.ReportPath)
+	}
+
+	return nil
+}
+
+func writeComparison(results []loadtest.StrategyResult, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(results); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/flygerian/assignment-system/loadtest"
+)
+
+// runConfig is everything that shapes a load test run. It can be loaded from a
+// JSON file with -config, and flags given on the command line override it.
+type runConfig struct {
+	Mode        string                     `json:"mode"`
+	Roster      loadtest.GeneratorOptions  `json:"roster"`
+	Traffic     loadtest.TrafficOptions    `json:"traffic"`
+	Simulation  loadtest.SimulationOptions `json:"simulation"`
+	Rate        int                        `json:"rate"` // Conversations arriving per second
+	Duration    jsonDuration               `json:"duration"`
+	BatchSize   int                        `json:"batch_size"`
+	BatchDelay  jsonDuration               `json:"batch_delay"`
+	Seed        int64                      `json:"seed"`        // Replays a previous run, zero picks a new seed
+	ReportPath  string                     `json:"report_path"` // Where to write the JSON report, if anywhere
+	Record      string                     `json:"record"`      // Where to record a trace of the run, if anywhere
+	Replay      string                     `json:"replay"`      // Trace to replay instead of generating a roster and traffic
+	Speed       float64                    `json:"speed"`       // Replay speed, 1 is as recorded and 0 as fast as possible
+	Strategies  string                     `json:"strategies"`  // Comma separated strategies to compare, empty for all of them
+	Audit       string                     `json:"audit"`       // Where to log sampled assignment decisions, if anywhere
+	AuditRate   float64                    `json:"audit_rate"`  // Share of conversations whose decisions are logged
+	Parallelism int                        `json:"parallelism"` // Goroutines a batch's accounts are spread over, 1 assigns sequentially
+}
+
+// Modes the runner can run in
+const (
+	// fillMode only ever adds conversations, measuring the system filling up
+	fillMode = "fill"
+	// steadyMode completes conversations and logs agents in and out
+	steadyMode = "steady"
+	// virtualMode is steadyMode on a virtual clock, running as fast as it can
+	virtualMode = "virtual"
+	// compareMode runs the workload on a virtual clock once per strategy
+	compareMode = "compare"
+)
+
+// jsonDuration reads durations such as "100s" from JSON
+type jsonDuration struct {
+	time.Duration
+}
+
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d jsonDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func defaultRunConfig() runConfig {
+	return runConfig{
+		Mode:        fillMode,
+		Roster:      loadtest.DefaultGeneratorOptions(),
+		Simulation:  loadtest.DefaultSimulationOptions(),
+		Traffic:     loadtest.DefaultTrafficOptions(),
+		Rate:        100,
+		Duration:    jsonDuration{100 * time.Second},
+		BatchSize:   100,
+		BatchDelay:  jsonDuration{time.Second},
+		Speed:       1,
+		AuditRate:   0.01,
+		Parallelism: 1,
+	}
+}
+
+func newFlagSet(config *runConfig) *flag.FlagSet {
+	flags := flag.NewFlagSet("assignment-loadtest", flag.ContinueOnError)
+	flags.StringVar(&config.Mode, "mode", config.Mode, "fill to only add conversations, steady to also complete them and log agents in and out, virtual for steady on a virtual clock, compare to run virtual once per strategy")
+	flags.IntVar(&config.Roster.TotalAgents, "agents", config.Roster.TotalAgents, "total number of agents")
+	flags.IntVar(&config.Roster.MinLimit, "min-limit", config.Roster.MinLimit, "lowest agent limit")
+	flags.IntVar(&config.Roster.MaxLimit, "max-limit", config.Roster.MaxLimit, "highest agent limit")
+	flags.Float64Var(&config.Roster.LargeAccountRatio, "large-account-ratio", config.Roster.LargeAccountRatio, "share of agents in large accounts")
+	flags.IntVar(&config.Roster.MinLargeAccountAgents, "min-large-account", config.Roster.MinLargeAccountAgents, "fewest agents in a large account")
+	flags.IntVar(&config.Roster.MaxLargeAccountAgents, "max-large-account", config.Roster.MaxLargeAccountAgents, "most agents in a large account")
+	flags.IntVar(&config.Roster.MinSmallAccountAgents, "min-small-account", config.Roster.MinSmallAccountAgents, "fewest agents in a small account")
+	flags.IntVar(&config.Roster.MaxSmallAccountAgents, "max-small-account", config.Roster.MaxSmallAccountAgents, "most agents in a small account")
+	flags.StringVar((*string)(&config.Traffic.Distribution), "distribution", string(config.Traffic.Distribution), "how traffic is spread across accounts: uniform, size or zipf")
+	flags.Float64Var(&config.Traffic.ZipfExponent, "zipf-exponent", config.Traffic.ZipfExponent, "skew of the zipf distribution")
+	flags.IntVar(&config.Traffic.DayTicks, "day-length", config.Traffic.DayTicks, "seconds in one daily traffic cycle, 0 for a constant rate")
+	flags.IntVar(&config.Traffic.PeakTick, "peak-at", config.Traffic.PeakTick, "second of the daily cycle with the most traffic")
+	flags.Float64Var(&config.Traffic.DiurnalAmplitude, "diurnal-amplitude", config.Traffic.DiurnalAmplitude, "how far the daily cycle moves the rate, from 0 to 1")
+	flags.Float64Var(&config.Traffic.BurstProbability, "burst-probability", config.Traffic.BurstProbability, "chance of a burst starting each second")
+	flags.Float64Var(&config.Traffic.BurstMultiplier, "burst-multiplier", config.Traffic.BurstMultiplier, "rate multiplier during a burst")
+	flags.IntVar(&config.Traffic.BurstTicks, "burst-length", config.Traffic.BurstTicks, "seconds a burst lasts")
+	flags.StringVar((*string)(&config.Simulation.HandleTime), "handle-time", string(config.Simulation.HandleTime), "handle time distribution in steady mode: fixed, exponential or lognormal")
+	flags.Float64Var(&config.Simulation.MeanHandleSeconds, "mean-handle", config.Simulation.MeanHandleSeconds, "mean seconds to handle a conversation in steady mode")
+	flags.Float64Var(&config.Simulation.HandleSecondsStdDev, "handle-stddev", config.Simulation.HandleSecondsStdDev, "standard deviation of lognormal handle times in seconds")
+	flags.Float64Var(&config.Simulation.MeanOnlineSeconds, "mean-online", config.Simulation.MeanOnlineSeconds, "mean seconds agents stay logged in during steady mode, 0 keeps them in")
+	flags.Float64Var(&config.Simulation.MeanAwaySeconds, "mean-away", config.Simulation.MeanAwaySeconds, "mean seconds agents stay logged out during steady mode")
+	flags.Float64Var(&config.Simulation.WarmupSeconds, "warmup", config.Simulation.WarmupSeconds, "seconds left out of the steady state report")
+	flags.BoolVar(&config.Simulation.QueueWhenFull, "queue", config.Simulation.QueueWhenFull, "let conversations wait for an agent instead of failing in steady, virtual and compare modes")
+	flags.IntVar(&config.Rate, "rate", config.Rate, "conversations arriving per second")
+	flags.DurationVar(&config.Duration.Duration, "duration", config.Duration.Duration, "how long to generate traffic for")
+	flags.IntVar(&config.BatchSize, "batch-size", config.BatchSize, "most conversations assigned in one batch")
+	flags.DurationVar(&config.BatchDelay.Duration, "batch-delay", config.BatchDelay.Duration, "longest a conversation waits for its batch to fill")
+	flags.StringVar(&config.ReportPath, "report-json", config.ReportPath, "file to write the run report to as JSON")
+	flags.StringVar(&config.Record, "record", config.Record, "file to record a trace of the run to")
+	flags.StringVar(&config.Replay, "replay", config.Replay, "trace to replay instead of generating a roster and traffic")
+	flags.Float64Var(&config.Speed, "speed", config.Speed, "replay speed, 1 is as recorded, 10 ten times faster and 0 as fast as possible")
+	flags.StringVar(&config.Strategies, "strategies", config.Strategies, "comma separated strategies to compare: least-recent, longest-idle, lowest-occupancy, all when empty")
+	flags.StringVar(&config.Audit, "audit", config.Audit, "file to log sampled assignment decisions to, rotated as it grows")
+	flags.Float64Var(&config.AuditRate, "audit-rate", config.AuditRate, "share of conversations whose assignment decisions are logged, from 0 to 1")
+	flags.IntVar(&config.Parallelism, "parallelism", config.Parallelism, "goroutines the accounts of a batch are assigned on, 1 assigns sequentially")
+	flags.Int64Var(&config.Seed, "seed", config.Seed, "random seed to replay a previous run, 0 picks a new one")
+
+	return flags
+}
+
+// loadRunConfig builds the configuration from defaults, an optional -config
+// file and then the remaining flags
+func loadRunConfig(args []string) (runConfig, error) {
+	config := defaultRunConfig()
+	flags := newFlagSet(&config)
+	configPath := flags.String("config", "", "JSON file to load the configuration from")
+	if err := flags.Parse(args); err != nil {
+		return runConfig{}, err
+	}
+
+	if *configPath != "" {
+		fromFile := defaultRunConfig()
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return runConfig{}, err
+		}
+		if err := json.Unmarshal(data, &fromFile); err != nil {
+			return runConfig{}, fmt.Errorf("reading %s: %w", *configPath, err)
+		}
+
+		// Flags given explicitly win over the file
+		overrides := newFlagSet(&fromFile)
+		var overrideErr error
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name != "config" && overrideErr == nil {
+				overrideErr = overrides.Set(f.Name, f.Value.String())
+			}
+		})
+		if overrideErr != nil {
+			return runConfig{}, overrideErr
+		}
+		config = fromFile
+	}
+
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+
+	return config, config.validate()
+}
+
+func (rc runConfig) validate() error {
+	if err := rc.Roster.Validate(); err != nil {
+		return err
+	}
+	if err := rc.Traffic.Validate(); err != nil {
+		return err
+	}
+	if err := rc.Simulation.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := loadtest.ParseStrategies(rc.Strategies); err != nil {
+		return err
+	}
+
+	switch {
+	case !slices.Contains([]string{fillMode, steadyMode, virtualMode, compareMode}, rc.Mode):
+		return fmt.Errorf("unknown mode %q", rc.Mode)
+	case rc.Mode == compareMode && rc.Record != "":
+		return fmt.Errorf("can't record a trace while comparing strategies")
+	case rc.Mode == compareMode && rc.Audit != "":
+		return fmt.Errorf("can't audit decisions while comparing strategies")
+	case rc.Mode == compareMode && rc.Parallelism > 1:
+		return fmt.Errorf("can't assign in parallel while comparing strategies")
+	case rc.AuditRate < 0 || rc.AuditRate > 1:
+		return fmt.Errorf("audit rate must be between 0 and 1, got %v", rc.AuditRate)
+	case rc.Speed < 0:
+		return fmt.Errorf("speed must not be negative, got %v", rc.Speed)
+	case rc.Replay != "" && rc.Replay == rc.Record:
+		return fmt.Errorf("can't record over the trace being replayed")
+	case rc.Rate < 1:
+		return fmt.Errorf("rate must be at least 1, got %d", rc.Rate)
+	case rc.Duration.Duration < time.Second:
+		return fmt.Errorf("duration must be at least a second, got %v", rc.Duration)
+	case rc.BatchSize < 1:
+		return fmt.Errorf("batch size must be at least 1, got %d", rc.BatchSize)
+	case rc.BatchDelay.Duration <= 0:
+		return fmt.Errorf("batch delay must be positive, got %v", rc.BatchDelay)
+	case rc.Parallelism < 1:
+		return fmt.Errorf("parallelism must be at least 1, got %d", rc.Parallelism)
+	}
+
+	return nil
+}
+
+// seconds is how many one second ticks of traffic the run generates
+func (rc runConfig) seconds() int {
+	return int(rc.Duration.Duration / time.Second)
+}
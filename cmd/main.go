@@ -1,82 +1,228 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/flygerian/assignment-system/assignmentsystem"
 	"github.com/flygerian/assignment-system/loadtest"
 )
 
+// stateFile is where the system's state is flushed when the run is interrupted
+const stateFile = "assignment_state.jsonl"
+
 func main() {
+	config, err := loadRunConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	fmt.Println("Starting assignment loop...")
 
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	// SIGINT/SIGTERM stop intake, the in-flight batch is still finished
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	random := loadtest.NewRand(config.Seed)
+	var agentWqs []assignmentsystem.AgentNameAndAccount
+	var traffic [][]assignmentsystem.ConversationToAssign
+	var trace *assignmentsystem.Trace
 
-	log.Printf("Generating work queues, this may take a while")
-	agentWqs := loadtest.GenerateAgentWorkQueues()
-	log.Printf("Making unique list of acccounts")
+	if config.Replay != "" {
+		log.Printf("Reading trace %s", config.Replay)
+		trace, err = readTrace(config.Replay)
+		if err != nil {
+			log.Fatal(err)
+		}
+		agentWqs = trace.Roster
+	} else {
+		log.Printf("Generating work queues, this may take a while")
+		log.Printf("Using seed %d", config.Seed)
+		agentWqs = loadtest.GenerateAgentWorkQueuesWithOptions(config.Roster, random)
+		log.Printf("Generating conversations")
+		traffic, err = loadtest.GenerateTraffic(agentWqs, config.Rate, config.seconds(), config.Traffic, random)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	accounts := loadtest.GetUniqueAccounts(agentWqs)
-	log.Printf("Generating conversations")
-	conversations := generateConversations(accounts, 10000)
+	if config.Mode == compareMode {
+		if err := runCompare(ctx, agentWqs, traffic, trace, config); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	system := assignmentsystem.NewAssignmentSystem(agentWqs)
+	system.SetParallelism(config.Parallelism)
+	seed := config.Seed
+	if trace != nil {
+		seed = 0 // Nothing is generated from it
+	}
+	recorder := loadtest.NewRecorder(seed, agentWqs)
+
+	var traceFile *os.File
+	if config.Record != "" {
+		if traceFile, err = os.Create(config.Record); err != nil {
+			log.Fatal(err)
+		}
+		if err := system.StartTrace(traceFile); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	assignmentInProgress := false
-	tickCounter := 0
+	if config.Audit != "" {
+		if err := system.StartAudit(assignmentsystem.AuditOptions{Path: config.Audit, SampleRate: config.AuditRate}); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	for {
-		select {
-		case <-ticker.C:
-			if !assignmentInProgress {
-				// Mark assignment as in progress
-				assignmentInProgress = true
+	switch {
+	case trace != nil:
+		err = loadtest.Replay(ctx, &system, trace, config.Speed, recorder.Record)
+	case config.Mode == steadyMode:
+		err = runSteady(ctx, &system, agentWqs, traffic, config.Simulation, random, recorder)
+	case config.Mode == virtualMode:
+		err = runVirtual(ctx, &system, agentWqs, traffic, config.Simulation, random, recorder)
+	default:
+		err = runFill(ctx, &system, traffic, config, recorder)
+	}
+
+	if traceFile != nil {
+		if err := errors.Join(system.StopTrace(), traceFile.Close()); err != nil {
+			log.Printf("Failed to record trace to %s: %v", config.Record, err)
+		}
+	}
+
+	if err := system.StopAudit(); err != nil {
+		log.Printf("Failed to write audit log to %s: %v", config.Audit, err)
+	}
+
+	recorder.SetFairness(system.FairnessByAccount())
+	report := recorder.Report()
+	switch {
+	case errors.Is(err, context.Canceled):
+		report.Interrupted = true
+		log.Printf("Interrupted, flushing state to %s", stateFile)
+		if err := flushState(&system, stateFile); err != nil {
+			log.Printf("Failed to flush state: %v", err)
+		}
+	case err != nil:
+		log.Fatal(err)
+	case trace != nil:
+		log.Printf("Replayed %d operations, exiting...", len(trace.Operations))
+	default:
+		log.Printf("Completed %d ticks, exiting...", config.seconds())
+	}
+
+	if err := report.WriteText(os.Stdout); err != nil {
+		log.Printf("Failed to write report: %v", err)
+	}
+	if config.ReportPath != "" {
+		if err := writeReport(report, config.ReportPath); err != nil {
+			log.Printf("Failed to write report to %s: %v", config.ReportPath, err)
+		}
+	}
+}
 
-				log.Printf("Starting assignment batch %d at %s", tickCounter+1, time.Now().Format("15:04:05"))
+// runFill feeds the traffic through a Dispatcher in real time. Conversations
+// are never completed, so it measures the system filling up.
+func runFill(ctx context.Context, system *assignmentsystem.AssignmentSystem, traffic [][]assignmentsystem.ConversationToAssign, config runConfig, recorder *loadtest.Recorder) error {
+	input := make(chan assignmentsystem.ConversationToAssign)
+	dispatcher := assignmentsystem.NewDispatcher(system, input, config.BatchSize, config.BatchDelay.Duration)
+
+	go produceConversations(ctx, input, traffic)
+
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		for batch := range dispatcher.Results() {
+			log.Printf("Completed assignment batch %d in %v", batch.Number, batch.Duration)
+			recorder.Record(batch)
+			if err := batch.Err(); err != nil {
+				// Record and carry on, we probably should have metrics here to measure failure and alerting
+				log.Printf("Assignment batch %d: %v", batch.Number, err)
+			}
+		}
+	}()
 
-				start := time.Now()
-				_, err := system.Assign(conversations[tickCounter*100 : (tickCounter+1)*100])
-				if err != nil {
-					log.Fatal(err)
-					// We probably should have metrics here to measure failure ans alerting
-				}
-				elapsed := time.Since(start)
+	err := dispatcher.Run(ctx)
+	<-reported
+
+	return err
+}
 
-				log.Printf("Completed assignment batch %d in %v", tickCounter+1, elapsed)
+// produceConversations feeds one tick of traffic into the dispatcher every
+// second and closes the input after the last tick or once ctx is done
+func produceConversations(ctx context.Context, input chan<- assignmentsystem.ConversationToAssign, traffic [][]assignmentsystem.ConversationToAssign) {
+	defer close(input)
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
 
-				tickCounter++
-				assignmentInProgress = false
+	for tickCounter, conversations := range traffic {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
-				// Exit after 100th tick (tickCounter will be 100 after increment)
-				if tickCounter >= 100 {
-					log.Println("Completed 100 ticks, exiting...")
-					return
-				}
+		log.Printf("Starting tick %d at %s with %d conversations", tickCounter+1, time.Now().Format("15:04:05"), len(conversations))
 
-			} else {
-				log.Println("Assignment in progress, skipping this tick")
+		for _, conversation := range conversations {
+			select {
+			case <-ctx.Done():
+				return
+			case input <- conversation:
 			}
 		}
 	}
 }
 
-// generateConversations creates 100 conversations to assign based on the tick number
-func generateConversations(accounts []string, numberToGenerate int) []assignmentsystem.ConversationToAssign {
-	conversations := make([]assignmentsystem.ConversationToAssign, numberToGenerate)
+func flushState(system *assignmentsystem.AssignmentSystem, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
 
-	for i := range numberToGenerate {
-		// Randomly select an account from the provided list
-		accountIndex := rand.Intn(len(accounts))
+	if err := system.WriteSnapshot(file); err != nil {
+		file.Close()
+		return err
+	}
 
-		conversations[i] = assignmentsystem.ConversationToAssign{
-			ConversationID: fmt.Sprintf("conversation-%d", i+1),
-			Account:        accounts[accountIndex],
-		}
+	return file.Close()
+}
+
+func writeReport(report loadtest.Report, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := report.WriteJSON(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func readTrace(path string) (*assignmentsystem.Trace, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
 
-	return conversations
+	return assignmentsystem.ReadTrace(file)
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+	"github.com/flygerian/assignment-system/loadtest"
+)
+
+// runSteady assigns one tick of traffic every second while a simulator
+// completes conversations and logs agents in and out, so the system settles
+// into a steady state instead of filling up
+func runSteady(ctx context.Context, system *assignmentsystem.AssignmentSystem, agents []assignmentsystem.AgentNameAndAccount, traffic [][]assignmentsystem.ConversationToAssign, options loadtest.SimulationOptions, random *rand.Rand, recorder *loadtest.Recorder) error {
+	simulator, err := loadtest.NewSimulator(system, agents, options, time.Now(), random)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		recorder.SetSteadyState(simulator.Report())
+	}()
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for tickCounter, conversations := range traffic {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			// The tick in flight is finished even if ctx is done meanwhile
+			step, err := simulator.Step(context.WithoutCancel(ctx), now, conversations)
+			if err != nil {
+				return err
+			}
+
+			recorder.Record(step.Batch)
+			log.Printf("Tick %d: %d arrivals in %v, %d completed, %d active, utilisation %.1f%%",
+				tickCounter+1, len(conversations), step.Batch.Duration, step.Completed, step.Active, 100*step.Utilisation())
+		}
+	}
+
+	return nil
+}
+
+// virtualProgressEvery is how much simulated time passes between progress logs
+// in virtual mode
+const virtualProgressEvery = time.Hour
+
+// runVirtual runs the same simulation as runSteady on a virtual clock, handling
+// arrivals, completions and agent logins in timestamp order without waiting
+// for real time to pass
+func runVirtual(ctx context.Context, system *assignmentsystem.AssignmentSystem, agents []assignmentsystem.AgentNameAndAccount, traffic [][]assignmentsystem.ConversationToAssign, options loadtest.SimulationOptions, random *rand.Rand, recorder *loadtest.Recorder) error {
+	start := time.Now()
+	simulator, err := loadtest.NewSimulator(system, agents, options, start, random)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		recorder.SetSteadyState(simulator.Report())
+	}()
+
+	nextProgress := start.Add(virtualProgressEvery)
+	return simulator.RunVirtual(ctx, traffic, time.Second, func(step loadtest.SimulationStep) {
+		recorder.Record(step.Batch)
+		recorder.SetSimulated(step.At.Sub(start) + time.Second)
+
+		if !step.At.Before(nextProgress) {
+			log.Printf("Simulated %v: %d active, utilisation %.1f%%", step.At.Sub(start), step.Active, 100*step.Utilisation())
+			nextProgress = nextProgress.Add(virtualProgressEvery)
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+)
+
+// Strategy is an assignment policy that can be compared against the others.
+// Every policy gives the conversation to one of the least loaded agents, they
+// differ in how ties between them are broken.
+type Strategy struct {
+	Name string
+	Mode assignmentsystem.SelectionMode
+}
+
+// Strategies are the policies the system supports, the default first
+var Strategies = []Strategy{
+	{Name: "least-recent", Mode: assignmentsystem.SelectLeastRecentAssignment},
+	{Name: "longest-idle", Mode: assignmentsystem.SelectLongestIdle},
+	{Name: "lowest-occupancy", Mode: assignmentsystem.SelectLowestOccupancy},
+}
+
+// ParseStrategies looks up a comma separated list of strategy names. An empty
+// list selects every strategy.
+func ParseStrategies(names string) ([]Strategy, error) {
+	if strings.TrimSpace(names) == "" {
+		return Strategies, nil
+	}
+
+	var strategies []Strategy
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, strategy := range Strategies {
+			if strategy.Name == name {
+				strategies = append(strategies, strategy)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown strategy %q", name)
+		}
+	}
+
+	return strategies, nil
+}
+
+// apply makes every account of the roster use the strategy
+func (s Strategy) apply(system *assignmentsystem.AssignmentSystem, agents []assignmentsystem.AgentNameAndAccount) {
+	for _, agent := range agents {
+		system.SetSelectionMode(agent.Account, s.Mode)
+	}
+}
+
+// AssignmentSpread describes how evenly conversations were spread across
+// agents, counting each agent's assignments relative to its Limit. Agents that
+// were given nothing are included.
+type AssignmentSpread struct {
+	Agents                 int     `json:"agents"`
+	MeanPerLimit           float64 `json:"mean_per_limit"`           // Mean assignments per unit of Limit
+	CoefficientOfVariation float64 `json:"coefficient_of_variation"` // Standard deviation over the mean, 0 is perfectly even
+	MaxMinRatio            float64 `json:"max_min_ratio"`            // Busiest over quietest agent, zero if an agent got nothing
+}
+
+// StrategyResult is how one strategy handled the workload
+type StrategyResult struct {
+	Strategy string `json:"strategy"`
+	Outcomes
+	FailureRate     float64          `json:"failure_rate"`
+	WaitingRate     float64          `json:"waiting_rate"`               // Share of conversations left waiting for an agent
+	MeanUtilisation float64          `json:"mean_utilisation,omitempty"` // After the warmup, only known for simulated workloads
+	MeanWait        time.Duration    `json:"mean_wait_ns,omitempty"`     // Of the conversations that waited and then got an agent, only known for simulated workloads
+	P99Wait         time.Duration    `json:"p99_wait_ns,omitempty"`
+	Spread          AssignmentSpread `json:"spread"`
+	Fairness        FairnessSummary  `json:"fairness"` // Within accounts
+	BatchLatency    LatencySummary   `json:"batch_latency"`
+}
+
+// strategyTally collects the results of one strategy's run
+type strategyTally struct {
+	outcomes  Outcomes
+	assigned  map[string]int
+	latencies []time.Duration
+	waits     []time.Duration
+}
+
+func newStrategyTally() *strategyTally {
+	return &strategyTally{assigned: make(map[string]int)}
+}
+
+func (t *strategyTally) record(batch assignmentsystem.DispatchedBatch) {
+	t.latencies = append(t.latencies, batch.Duration)
+	for _, result := range batch.Results {
+		t.outcomes.record(result)
+		if result.Err == nil && !result.Waiting {
+			t.assigned[result.AgentName]++
+		}
+	}
+}
+
+func (t *strategyTally) recordDequeued(dequeued []DequeuedConversation) {
+	for _, conversation := range dequeued {
+		t.waits = append(t.waits, conversation.Waited)
+	}
+}
+
+func (t *strategyTally) result(strategy Strategy, system *assignmentsystem.AssignmentSystem, agents []assignmentsystem.AgentNameAndAccount) StrategyResult {
+	result := StrategyResult{
+		Strategy:     strategy.Name,
+		Outcomes:     t.outcomes,
+		FailureRate:  t.outcomes.FailureRate(),
+		Spread:       spreadOf(t.assigned, agents),
+		Fairness:     SummariseFairness(system.FairnessByAccount()),
+		BatchLatency: summariseLatencies(t.latencies),
+	}
+	if t.outcomes.Conversations > 0 {
+		result.WaitingRate = float64(t.outcomes.Waiting) / float64(t.outcomes.Conversations)
+	}
+	waits := summariseLatencies(t.waits)
+	result.MeanWait, result.P99Wait = waits.Mean, waits.P99
+
+	return result
+}
+
+// spreadOf measures the assignments of every agent in the roster against its
+// limit. Agents without capacity can't be given anything and are left out.
+func spreadOf(assigned map[string]int, agents []assignmentsystem.AgentNameAndAccount) AssignmentSpread {
+	var perLimit []float64
+	seen := make(map[string]bool)
+	for _, agent := range agents {
+		// Repeated names are one agent in several accounts
+		if seen[agent.Name] || agent.Limit <= 0 {
+			continue
+		}
+		seen[agent.Name] = true
+		perLimit = append(perLimit, float64(assigned[agent.Name])/float64(agent.Limit))
+	}
+
+	if len(perLimit) == 0 {
+		return AssignmentSpread{}
+	}
+
+	spread := AssignmentSpread{Agents: len(perLimit)}
+	lowest, highest := perLimit[0], perLimit[0]
+	for _, value := range perLimit {
+		spread.MeanPerLimit += value
+		lowest = min(lowest, value)
+		highest = max(highest, value)
+	}
+	spread.MeanPerLimit /= float64(len(perLimit))
+
+	if spread.MeanPerLimit > 0 {
+		var variance float64
+		for _, value := range perLimit {
+			variance += (value - spread.MeanPerLimit) * (value - spread.MeanPerLimit)
+		}
+		spread.CoefficientOfVariation = math.Sqrt(variance/float64(len(perLimit))) / spread.MeanPerLimit
+	}
+
+	if lowest > 0 {
+		spread.MaxMinRatio = highest / lowest
+	}
+
+	return spread
+}
+
+// CompareSimulated runs the same simulated workload once per strategy, each
+// against a fresh system built from the roster. Every run starts from the same
+// seed, so the traffic, handle times and agent breaks only differ where the
+// strategies' decisions make them.
+func CompareSimulated(ctx context.Context, agents []assignmentsystem.AgentNameAndAccount, traffic [][]assignmentsystem.ConversationToAssign, options SimulationOptions, start time.Time, seed int64, strategies []Strategy) ([]StrategyResult, error) {
+	results := make([]StrategyResult, 0, len(strategies))
+
+	for _, strategy := range strategies {
+		system := assignmentsystem.NewAssignmentSystem(agents)
+		strategy.apply(&system, agents)
+
+		simulator, err := NewSimulator(&system, agents, options, start, NewRand(seed))
+		if err != nil {
+			return nil, err
+		}
+
+		tally := newStrategyTally()
+		err = simulator.RunVirtual(ctx, traffic, time.Second, func(step SimulationStep) {
+			tally.record(step.Batch)
+			tally.recordDequeued(step.Dequeued)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("strategy %s: %w", strategy.Name, err)
+		}
+
+		result := tally.result(strategy, &system, agents)
+		result.MeanUtilisation = simulator.Report().MeanUtilisation
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// CompareReplayed replays a recorded trace once per strategy, as fast as
+// possible, each against a fresh system built from the trace's roster
+func CompareReplayed(ctx context.Context, trace *assignmentsystem.Trace, strategies []Strategy) ([]StrategyResult, error) {
+	results := make([]StrategyResult, 0, len(strategies))
+
+	for _, strategy := range strategies {
+		system := assignmentsystem.NewAssignmentSystem(trace.Roster)
+		strategy.apply(&system, trace.Roster)
+
+		tally := newStrategyTally()
+		if err := Replay(ctx, &system, trace, 0, tally.record); err != nil {
+			return nil, fmt.Errorf("strategy %s: %w", strategy.Name, err)
+		}
+
+		results = append(results, tally.result(strategy, &system, trace.Roster))
+	}
+
+	return results, nil
+}
+
+// WriteComparison writes the results side by side for people to read
+func WriteComparison(w io.Writer, results []StrategyResult) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintln(table, "strategy\tconversations\tfailed\twaiting\tmean wait\twait p99\tutilisation\tspread (cv)\tmax/min\tmean gini\tbatch p99\t")
+	for _, result := range results {
+		meanWait, p99Wait, utilisation, maxMin := "-", "-", "-", "-"
+		if result.P99Wait > 0 {
+			meanWait, p99Wait = result.MeanWait.Round(time.Millisecond).String(), result.P99Wait.Round(time.Millisecond).String()
+		}
+		if result.MeanUtilisation > 0 {
+			utilisation = fmt.Sprintf("%.1f%%", 100*result.MeanUtilisation)
+		}
+		if result.Spread.MaxMinRatio > 0 {
+			maxMin = fmt.Sprintf("%.2f", result.Spread.MaxMinRatio)
+		}
+		fmt.Fprintf(table, "%s\t%d\t%.2f%%\t%.2f%%\t%s\t%s\t%s\t%.3f\t%s\t%.3f\t%v\t\n",
+			result.Strategy, result.Conversations, 100*result.FailureRate, 100*result.WaitingRate,
+			meanWait, p99Wait, utilisation, result.Spread.CoefficientOfVariation, maxMin, result.Fairness.MeanGini, result.BatchLatency.P99)
+	}
+
+	return table.Flush()
+}
@@ -0,0 +1,206 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+)
+
+func TestParseStrategies(t *testing.T) {
+	all, err := ParseStrategies("")
+	if err != nil || len(all) != len(Strategies) {
+		t.Errorf("Expected every strategy for an empty list, got %v, %v", all, err)
+	}
+
+	picked, err := ParseStrategies("lowest-occupancy, least-recent")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(picked) != 2 || picked[0].Mode != assignmentsystem.SelectLowestOccupancy || picked[1].Mode != assignmentsystem.SelectLeastRecentAssignment {
+		t.Errorf("Expected the strategies in the order given, got %v", picked)
+	}
+
+	if _, err := ParseStrategies("least-recent,random"); err == nil {
+		t.Errorf("Expected an error for an unknown strategy")
+	}
+}
+
+func TestSpreadOf(t *testing.T) {
+	agents := []assignmentsystem.AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+		{Name: "agent2", Account: "account1", Limit: 2},
+		{Name: "agent2", Account: "account2", Limit: 2}, // Shared, counted once
+		{Name: "agent3", Account: "account2", Limit: 0}, // Can't take anything
+	}
+
+	tests := []struct {
+		name     string
+		assigned map[string]int
+		expected AssignmentSpread
+	}{
+		{
+			name:     "Even relative to the limits",
+			assigned: map[string]int{"agent1": 3, "agent2": 6},
+			expected: AssignmentSpread{Agents: 2, MeanPerLimit: 3, CoefficientOfVariation: 0, MaxMinRatio: 1},
+		},
+		{
+			name:     "Uneven",
+			assigned: map[string]int{"agent1": 1, "agent2": 6},
+			expected: AssignmentSpread{Agents: 2, MeanPerLimit: 2, CoefficientOfVariation: 0.5, MaxMinRatio: 3},
+		},
+		{
+			name:     "An agent got nothing",
+			assigned: map[string]int{"agent2": 2},
+			expected: AssignmentSpread{Agents: 2, MeanPerLimit: 0.5, CoefficientOfVariation: 1, MaxMinRatio: 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spread := spreadOf(test.assigned, agents)
+			if spread.Agents != test.expected.Agents || spread.MaxMinRatio != test.expected.MaxMinRatio ||
+				math.Abs(spread.MeanPerLimit-test.expected.MeanPerLimit) > 1e-9 ||
+				math.Abs(spread.CoefficientOfVariation-test.expected.CoefficientOfVariation) > 1e-9 {
+				t.Errorf("Expected %+v, got %+v", test.expected, spread)
+			}
+		})
+	}
+}
+
+func TestCompareSimulated(t *testing.T) {
+	agents := trafficRoster()
+	traffic, err := GenerateTraffic(agents, 20, 120, DefaultTrafficOptions(), NewRand(5))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	options := SimulationOptions{HandleTime: ExponentialHandleTime, MeanHandleSeconds: 5}
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	results, err := CompareSimulated(context.Background(), agents, traffic, options, start, 5, Strategies)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(results) != len(Strategies) {
+		t.Fatalf("Expected a result per strategy, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Strategy != Strategies[i].Name {
+			t.Errorf("Expected result %d to be for %s, got %s", i, Strategies[i].Name, result.Strategy)
+		}
+		// Every strategy sees the same workload
+		if result.Conversations != 20*120 || result.Assigned != result.Conversations {
+			t.Errorf("Expected all %d conversations assigned, got %+v", 20*120, result.Outcomes)
+		}
+		if result.MeanUtilisation <= 0 || result.Spread.Agents != len(agents) || result.Fairness.Accounts != 2 {
+			t.Errorf("Expected utilisation and spread for every agent, got %+v", result)
+		}
+	}
+
+	// The same seed gives the same results
+	again, err := CompareSimulated(context.Background(), agents, traffic, options, start, 5, Strategies[:1])
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if again[0].Spread != results[0].Spread {
+		t.Errorf("Expected a repeated run to match, got %+v and %+v", results[0].Spread, again[0].Spread)
+	}
+}
+
+func TestCompareSimulatedWaits(t *testing.T) {
+	agents := []assignmentsystem.AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+		{Name: "agent2", Account: "account1", Limit: 1},
+	}
+	traffic, err := GenerateTraffic(agents, 1, 60, DefaultTrafficOptions(), NewRand(5))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Three seconds of work a second for two agents, most conversations wait
+	options := SimulationOptions{HandleTime: FixedHandleTime, MeanHandleSeconds: 3, QueueWhenFull: true}
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	results, err := CompareSimulated(context.Background(), agents, traffic, options, start, 5, Strategies[:1])
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	result := results[0]
+	if result.Failed != 0 || result.WaitingRate == 0 {
+		t.Fatalf("Expected conversations to wait rather than fail, got %+v", result.Outcomes)
+	}
+	// The queue keeps growing, so later conversations wait longer
+	if result.MeanWait < 5*time.Second || result.P99Wait <= result.MeanWait {
+		t.Errorf("Expected the waits to grow over the run, got mean %v and p99 %v", result.MeanWait, result.P99Wait)
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteComparison(&buffer, results); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, expected := range []string{"mean wait", "wait p99", result.P99Wait.Round(time.Millisecond).String()} {
+		if !strings.Contains(buffer.String(), expected) {
+			t.Errorf("Expected the comparison to contain %q, got\n%s", expected, buffer.String())
+		}
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(string(encoded), fmt.Sprintf(`"p99_wait_ns":%d`, result.P99Wait)) {
+		t.Errorf("Expected the JSON to carry the wait, got %s", encoded)
+	}
+}
+
+func TestCompareReplayed(t *testing.T) {
+	agents := []assignmentsystem.AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 1},
+		{Name: "agent2", Account: "account1", Limit: 1},
+	}
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	conversation := func(id string) []assignmentsystem.ConversationToAssign {
+		return []assignmentsystem.ConversationToAssign{{ConversationID: id, Account: "account1"}}
+	}
+	trace := &assignmentsystem.Trace{
+		Roster: agents,
+		Operations: []assignmentsystem.TraceRecord{
+			{At: start, Op: assignmentsystem.TraceAssign, Conversations: conversation("conv1")},
+			{At: start.Add(time.Minute), Op: assignmentsystem.TraceAssign, Conversations: conversation("conv2")},
+			{At: start.Add(2 * time.Minute), Op: assignmentsystem.TraceAssign, Conversations: conversation("conv3")},
+			{At: start.Add(3 * time.Minute), Op: assignmentsystem.TraceComplete, ConversationID: "conv1"},
+			{At: start.Add(4 * time.Minute), Op: assignmentsystem.TraceAssign, Conversations: conversation("conv4")},
+		},
+	}
+
+	results, err := CompareReplayed(context.Background(), trace, Strategies[:2])
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, result := range results {
+		if result.Outcomes != (Outcomes{Conversations: 4, Assigned: 3, Failed: 1}) {
+			t.Errorf("Unexpected outcomes for %s: %+v", result.Strategy, result.Outcomes)
+		}
+		if result.MeanUtilisation != 0 {
+			t.Errorf("Expected no utilisation for a replay, got %v", result.MeanUtilisation)
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteComparison(&buffer, results); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, expected := range []string{"least-recent", "longest-idle", "25.00%"} {
+		if !strings.Contains(buffer.String(), expected) {
+			t.Errorf("Expected the comparison to contain %q, got\n%s", expected, buffer.String())
+		}
+	}
+}
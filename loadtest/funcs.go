@@ -4,37 +4,85 @@ import (
 	"fmt"
 	"math/rand"
 	"slices"
+	"time"
 
 	"github.com/flygerian/assignment-system/assignmentsystem"
 )
 
+// GeneratorOptions describes the shape of a generated roster
+type GeneratorOptions struct {
+	TotalAgents int `json:"total_agents"`
+	MinLimit    int `json:"min_limit"`
+	MaxLimit    int `json:"max_limit"`
+
+	// Share of the agents that belong to large accounts, the rest are in small ones
+	LargeAccountRatio float64 `json:"large_account_ratio"`
+
+	MinLargeAccountAgents int `json:"min_large_account_agents"`
+	MaxLargeAccountAgents int `json:"max_large_account_agents"`
+	MinSmallAccountAgents int `json:"min_small_account_agents"`
+	MaxSmallAccountAgents int `json:"max_small_account_agents"`
+}
+
+// DefaultGeneratorOptions is 1 million agents with limits from 5-20, 20% of
+// them in large accounts of 1000-5000 agents and 80% in small accounts of
+// 10-100 agents
+func DefaultGeneratorOptions() GeneratorOptions {
+	return GeneratorOptions{
+		TotalAgents:           1_000_000,
+		MinLimit:              5,
+		MaxLimit:              20,
+		LargeAccountRatio:     0.2,
+		MinLargeAccountAgents: 1000,
+		MaxLargeAccountAgents: 5000,
+		MinSmallAccountAgents: 10,
+		MaxSmallAccountAgents: 100,
+	}
+}
+
+// Validate reports options the generator can't work with
+func (o GeneratorOptions) Validate() error {
+	switch {
+	case o.TotalAgents < 0:
+		return fmt.Errorf("total agents must not be negative, got %d", o.TotalAgents)
+	case o.MinLimit < 1 || o.MaxLimit < o.MinLimit:
+		return fmt.Errorf("invalid limit range %d-%d", o.MinLimit, o.MaxLimit)
+	case o.LargeAccountRatio < 0 || o.LargeAccountRatio > 1:
+		return fmt.Errorf("large account ratio must be between 0 and 1, got %v", o.LargeAccountRatio)
+	case o.MinLargeAccountAgents < 1 || o.MaxLargeAccountAgents < o.MinLargeAccountAgents:
+		return fmt.Errorf("invalid large account size range %d-%d", o.MinLargeAccountAgents, o.MaxLargeAccountAgents)
+	case o.MinSmallAccountAgents < 1 || o.MaxSmallAccountAgents < o.MinSmallAccountAgents:
+		return fmt.Errorf("invalid small account size range %d-%d", o.MinSmallAccountAgents, o.MaxSmallAccountAgents)
+	}
+
+	return nil
+}
+
 // GenerateAgentWorkQueues creates 1 million agents with varying limits from 5-20,
 // distributed unevenly across accounts (large accounts and small accounts)
 func GenerateAgentWorkQueues() []assignmentsystem.AgentNameAndAccount {
-	const totalAgents = 1_000_000
-	const minLimit = 5
-	const maxLimit = 20
-
-	// Create account distribution: 80% small accounts, 20% large accounts
-	const largeAccountRatio = 0.2
-	const smallAccountRatio = 0.8
+	return GenerateAgentWorkQueuesWithOptions(DefaultGeneratorOptions(), NewRand(time.Now().UnixNano()))
+}
 
-	// Large accounts will have 1000-5000 agents, small accounts will have 10-100 agents
-	const minLargeAccountAgents = 1000
-	const maxLargeAccountAgents = 5000
-	const minSmallAccountAgents = 10
-	const maxSmallAccountAgents = 100
+// NewRand returns the random source the generators draw from. Passing the
+// same seed to every generator of a run makes it replay exactly.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
 
+// GenerateAgentWorkQueuesWithOptions creates a roster with the given shape,
+// drawing every random choice from random
+func GenerateAgentWorkQueuesWithOptions(options GeneratorOptions, random *rand.Rand) []assignmentsystem.AgentNameAndAccount {
 	var agents []assignmentsystem.AgentNameAndAccount
 	agentsCreated := 0
 	accountID := 1
 
-	// Create large accounts first (20% of agents)
-	targetLargeAgents := int(float64(totalAgents) * largeAccountRatio)
+	// Create large accounts first
+	targetLargeAgents := int(float64(options.TotalAgents) * options.LargeAccountRatio)
 	largeAgentsCreated := 0
 
 	for largeAgentsCreated < targetLargeAgents {
-		agentsInThisAccount := rand.Intn(maxLargeAccountAgents-minLargeAccountAgents+1) + minLargeAccountAgents
+		agentsInThisAccount := random.Intn(options.MaxLargeAccountAgents-options.MinLargeAccountAgents+1) + options.MinLargeAccountAgents
 		if largeAgentsCreated+agentsInThisAccount > targetLargeAgents {
 			agentsInThisAccount = targetLargeAgents - largeAgentsCreated
 		}
@@ -44,7 +92,7 @@ func GenerateAgentWorkQueues() []assignmentsystem.AgentNameAndAccount {
 			agent := assignmentsystem.AgentNameAndAccount{
 				Name:    fmt.Sprintf("agent_%s_%d", accountName, i+1),
 				Account: accountName,
-				Limit:   rand.Intn(maxLimit-minLimit+1) + minLimit,
+				Limit:   random.Intn(options.MaxLimit-options.MinLimit+1) + options.MinLimit,
 			}
 			agents = append(agents, agent)
 		}
@@ -54,12 +102,12 @@ func GenerateAgentWorkQueues() []assignmentsystem.AgentNameAndAccount {
 		accountID++
 	}
 
-	// Create small accounts (remaining 80% of agents)
-	targetSmallAgents := totalAgents - targetLargeAgents
+	// Create small accounts with the remaining agents
+	targetSmallAgents := options.TotalAgents - targetLargeAgents
 	smallAgentsCreated := 0
 
 	for smallAgentsCreated < targetSmallAgents {
-		agentsInThisAccount := rand.Intn(maxSmallAccountAgents-minSmallAccountAgents+1) + minSmallAccountAgents
+		agentsInThisAccount := random.Intn(options.MaxSmallAccountAgents-options.MinSmallAccountAgents+1) + options.MinSmallAccountAgents
 		if smallAgentsCreated+agentsInThisAccount > targetSmallAgents {
 			agentsInThisAccount = targetSmallAgents - smallAgentsCreated
 		}
@@ -69,7 +117,7 @@ func GenerateAgentWorkQueues() []assignmentsystem.AgentNameAndAccount {
 			agent := assignmentsystem.AgentNameAndAccount{
 				Name:    fmt.Sprintf("agent_%s_%d", accountName, i+1),
 				Account: accountName,
-				Limit:   rand.Intn(maxLimit-minLimit+1) + minLimit,
+				Limit:   random.Intn(options.MaxLimit-options.MinLimit+1) + options.MinLimit,
 			}
 			agents = append(agents, agent)
 		}
@@ -80,13 +128,46 @@ func GenerateAgentWorkQueues() []assignmentsystem.AgentNameAndAccount {
 	}
 
 	// Shuffle the agents to ensure random distribution
-	rand.Shuffle(len(agents), func(i, j int) {
+	random.Shuffle(len(agents), func(i, j int) {
 		agents[i], agents[j] = agents[j], agents[i]
 	})
 
 	return agents
 }
 
+// GenerateAccountAgents creates an account staffed by the given number of
+// agents, all with the same limit
+func GenerateAccountAgents(account string, agents int, limit int) []assignmentsystem.AgentNameAndAccount {
+	roster := make([]assignmentsystem.AgentNameAndAccount, agents)
+	for i := range agents {
+		roster[i] = assignmentsystem.AgentNameAndAccount{
+			Name:    fmt.Sprintf("agent_%s_%d", account, i+1),
+			Account: account,
+			Limit:   limit,
+		}
+	}
+
+	return roster
+}
+
+// GenerateConversations creates numberToGenerate conversations spread
+// uniformly across the given accounts
+func GenerateConversations(accounts []string, numberToGenerate int, random *rand.Rand) []assignmentsystem.ConversationToAssign {
+	conversations := make([]assignmentsystem.ConversationToAssign, numberToGenerate)
+
+	for i := range numberToGenerate {
+		// Randomly select an account from the provided list
+		accountIndex := random.Intn(len(accounts))
+
+		conversations[i] = assignmentsystem.ConversationToAssign{
+			ConversationID: fmt.Sprintf("conversation-%d", i+1),
+			Account:        accounts[accountIndex],
+		}
+	}
+
+	return conversations
+}
+
 func GetUniqueAccounts(agents []assignmentsystem.AgentNameAndAccount) []string {
 	var uniqueAccounts []string
 
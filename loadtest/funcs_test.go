@@ -1,6 +1,9 @@
 package loadtest
 
 import (
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/flygerian/assignment-system/assignmentsystem"
@@ -72,6 +75,141 @@ func TestGenerateAgentWorkQueues(t *testing.T) {
 	}
 }
 
+func TestGenerateAgentWorkQueuesWithOptions(t *testing.T) {
+	options := GeneratorOptions{
+		TotalAgents:           10_000,
+		MinLimit:              1,
+		MaxLimit:              3,
+		LargeAccountRatio:     0.5,
+		MinLargeAccountAgents: 1000,
+		MaxLargeAccountAgents: 2000,
+		MinSmallAccountAgents: 5,
+		MaxSmallAccountAgents: 10,
+	}
+	if err := options.Validate(); err != nil {
+		t.Fatalf("Expected valid options, got %v", err)
+	}
+
+	agents := GenerateAgentWorkQueuesWithOptions(options, NewRand(1))
+
+	if len(agents) != 10_000 {
+		t.Errorf("Expected 10,000 agents, got %d", len(agents))
+	}
+
+	accountMap := make(map[string]int)
+	for _, agent := range agents {
+		if agent.Limit < 1 || agent.Limit > 3 {
+			t.Errorf("Agent %s has invalid limit %d, expected 1-3", agent.Name, agent.Limit)
+		}
+		accountMap[agent.Account]++
+	}
+
+	// The last account of each kind is cut short to hit the target exactly
+	largeAgents, undersizedLarge, undersizedSmall := 0, 0, 0
+	for account, count := range accountMap {
+		if strings.HasPrefix(account, "large_account_") {
+			largeAgents += count
+			if count > 2000 {
+				t.Errorf("Account %s has %d agents, expected at most 2000", account, count)
+			}
+			if count < 1000 {
+				undersizedLarge++
+			}
+			continue
+		}
+
+		if count > 10 {
+			t.Errorf("Account %s has %d agents, expected at most 10", account, count)
+		}
+		if count < 5 {
+			undersizedSmall++
+		}
+	}
+
+	if undersizedLarge > 1 || undersizedSmall > 1 {
+		t.Errorf("Expected at most one undersized account of each kind, got %d large and %d small", undersizedLarge, undersizedSmall)
+	}
+
+	if largeAgents != 5_000 {
+		t.Errorf("Expected 5,000 agents in large accounts, got %d", largeAgents)
+	}
+}
+
+func TestGenerateWithSeedReplays(t *testing.T) {
+	options := DefaultGeneratorOptions()
+	options.TotalAgents = 5_000
+
+	generate := func(seed int64) ([]assignmentsystem.AgentNameAndAccount, []assignmentsystem.ConversationToAssign) {
+		random := NewRand(seed)
+		agents := GenerateAgentWorkQueuesWithOptions(options, random)
+		return agents, GenerateConversations(GetUniqueAccounts(agents), 1_000, random)
+	}
+
+	agents, conversations := generate(42)
+	replayedAgents, replayedConversations := generate(42)
+
+	if !slices.Equal(agents, replayedAgents) {
+		t.Errorf("Expected the same roster for the same seed")
+	}
+	if !slices.Equal(conversations, replayedConversations) {
+		t.Errorf("Expected the same conversations for the same seed")
+	}
+
+	otherAgents, otherConversations := generate(43)
+	if slices.Equal(agents, otherAgents) && slices.Equal(conversations, otherConversations) {
+		t.Errorf("Expected a different run for a different seed")
+	}
+}
+
+func TestGenerateAccountAgents(t *testing.T) {
+	agents := GenerateAccountAgents("account1", 3, 4)
+
+	expected := []assignmentsystem.AgentNameAndAccount{
+		{Name: "agent_account1_1", Account: "account1", Limit: 4},
+		{Name: "agent_account1_2", Account: "account1", Limit: 4},
+		{Name: "agent_account1_3", Account: "account1", Limit: 4},
+	}
+	if !slices.Equal(agents, expected) {
+		t.Errorf("Expected %v, got %v", expected, agents)
+	}
+}
+
+func TestGenerateConversations(t *testing.T) {
+	accounts := []string{"accountA", "accountB"}
+	conversations := GenerateConversations(accounts, 100, NewRand(1))
+
+	if len(conversations) != 100 {
+		t.Errorf("Expected 100 conversations, got %d", len(conversations))
+	}
+
+	for i, conversation := range conversations {
+		if expected := fmt.Sprintf("conversation-%d", i+1); conversation.ConversationID != expected {
+			t.Errorf("Expected conversation ID %s, got %s", expected, conversation.ConversationID)
+		}
+		if !slices.Contains(accounts, conversation.Account) {
+			t.Errorf("Conversation %s has unexpected account %s", conversation.ConversationID, conversation.Account)
+		}
+	}
+}
+
+func TestGeneratorOptionsValidate(t *testing.T) {
+	if err := DefaultGeneratorOptions().Validate(); err != nil {
+		t.Errorf("Expected default options to be valid, got %v", err)
+	}
+
+	invalid := DefaultGeneratorOptions()
+	invalid.MaxLimit = invalid.MinLimit - 1
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected an error for an empty limit range")
+	}
+
+	invalid = DefaultGeneratorOptions()
+	invalid.LargeAccountRatio = 1.5
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected an error for a large account ratio above 1")
+	}
+}
+
 func TestGetUniqueAccounts(t *testing.T) {
 	// Test case 1: Multiple agents with duplicate accounts
 	agents := []assignmentsystem.AgentNameAndAccount{
@@ -0,0 +1,94 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+)
+
+// Replay plays the operations of a trace back against a system built from
+// the trace's roster. The system's clock follows the trace, so time based
+// decisions come out as they did when it was recorded. A speed of 1 paces the
+// operations as they were recorded, 10 ten times faster and 0 as fast as
+// possible. onBatch is called with the results of every assign operation.
+//
+// The trace holds the operations but not the configuration, so system has to
+// be set up as the recorded one was, with the same overflow chains, business
+// hours, selection modes, wrap-up and batch matching, for the decisions to come
+// out the same. Conversations in progress or waiting when the recording started
+// are not replayed either.
+func Replay(ctx context.Context, system *assignmentsystem.AssignmentSystem, trace *assignmentsystem.Trace, speed float64, onBatch func(assignmentsystem.DispatchedBatch)) error {
+	if speed < 0 {
+		return fmt.Errorf("speed must not be negative, got %v", speed)
+	}
+	if len(trace.Operations) == 0 {
+		return nil
+	}
+
+	agents := make(map[string]bool)
+	for _, agent := range trace.Roster {
+		agents[agent.Name] = true
+	}
+
+	traceStart := trace.Operations[0].At
+	now := traceStart
+	system.SetClock(func() time.Time { return now })
+
+	replayStart := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	batchNumber := 0
+
+	for i, operation := range trace.Operations {
+		if speed > 0 {
+			due := replayStart.Add(time.Duration(float64(operation.At.Sub(traceStart)) / speed))
+			timer.Reset(time.Until(due))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		now = operation.At
+
+		switch operation.Op {
+		case assignmentsystem.TraceAssign:
+			batchNumber++
+			started := time.Now()
+			// An operation that has started is finished even if ctx is done meanwhile
+			results := system.AssignResults(context.WithoutCancel(ctx), operation.Conversations)
+			onBatch(assignmentsystem.DispatchedBatch{
+				Number:   batchNumber,
+				Results:  results,
+				Started:  started,
+				Duration: time.Since(started),
+			})
+		case assignmentsystem.TraceComplete:
+			// Conversations that were in progress when the trace started, or
+			// that were never assigned, are unknown here as they were then
+			err := system.Complete(operation.ConversationID)
+			if err != nil && !errors.Is(err, assignmentsystem.ErrUnknownConversation) {
+				return fmt.Errorf("trace operation %d: %w", i+1, err)
+			}
+		case assignmentsystem.TraceSetLimit:
+			if !agents[operation.AgentName] {
+				return fmt.Errorf("trace operation %d: %w: %s", i+1, assignmentsystem.ErrUnknownAgent, operation.AgentName)
+			}
+			system.SetLimit(operation.AgentName, operation.Limit)
+		case assignmentsystem.TraceSetStatus:
+			if err := system.SetStatus(operation.AgentName, operation.Status); err != nil {
+				return fmt.Errorf("trace operation %d: %w", i+1, err)
+			}
+		case assignmentsystem.TraceReevaluate:
+			system.ReevaluateWaiting()
+		}
+	}
+
+	return nil
+}
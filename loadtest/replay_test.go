@@ -0,0 +1,265 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+)
+
+func TestReplayReproducesRecordedRun(t *testing.T) {
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	agents := trafficRoster()
+
+	// Record a short simulation with completions and agents logging in and out
+	original := assignmentsystem.NewAssignmentSystem(agents)
+	var buffer bytes.Buffer
+	if err := original.StartTrace(&buffer); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	options := SimulationOptions{HandleTime: ExponentialHandleTime, MeanHandleSeconds: 20, MeanOnlineSeconds: 30, MeanAwaySeconds: 10}
+	simulator, err := NewSimulator(&original, agents, options, start, NewRand(3))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	traffic, err := GenerateTraffic(agents, 40, 60, DefaultTrafficOptions(), NewRand(3))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var recorded []assignmentsystem.AssignmentResult
+	err = simulator.RunVirtual(context.Background(), traffic, time.Second, func(step SimulationStep) {
+		recorded = append(recorded, step.Batch.Results...)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := original.StopTrace(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	trace, err := assignmentsystem.ReadTrace(&buffer)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	replayed := assignmentsystem.NewAssignmentSystem(trace.Roster)
+	var results []assignmentsystem.AssignmentResult
+	err = Replay(context.Background(), &replayed, trace, 0, func(batch assignmentsystem.DispatchedBatch) {
+		results = append(results, batch.Results...)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(results) != len(recorded) {
+		t.Fatalf("Expected %d results, got %d", len(recorded), len(results))
+	}
+	failures := 0
+	for i := range recorded {
+		if results[i].AgentName != recorded[i].AgentName || !errors.Is(results[i].Err, recorded[i].Err) {
+			t.Fatalf("Result %d differs: recorded %+v, replayed %+v", i, recorded[i], results[i])
+		}
+		if recorded[i].Err != nil {
+			failures++
+		}
+	}
+	// Make sure the run was busy enough to be interesting
+	if failures == 0 {
+		t.Errorf("Expected some failures with agents logging out")
+	}
+}
+
+func TestReplayReproducesWaitingAndShifts(t *testing.T) {
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	var roster []assignmentsystem.AgentNameAndAccount
+	for i := range 3 {
+		roster = append(roster, assignmentsystem.AgentNameAndAccount{Name: fmt.Sprintf("tier1_%d", i), Account: "account1", Limit: 2, Team: "tier1"})
+		roster = append(roster, assignmentsystem.AgentNameAndAccount{Name: fmt.Sprintf("tier2_%d", i), Account: "account1", Limit: 1, Team: "tier2"})
+	}
+	roster = append(roster,
+		assignmentsystem.AgentNameAndAccount{Name: "shared", Account: "account1", Limit: 2},
+		assignmentsystem.AgentNameAndAccount{Name: "shared", Account: "account2"},
+		assignmentsystem.AgentNameAndAccount{Name: "other", Account: "account2", Limit: 1},
+	)
+
+	// The configuration isn't part of the trace, both systems get the same
+	configure := func(system *assignmentsystem.AssignmentSystem, auditPath string) {
+		system.SetOverflowChain("account1", []assignmentsystem.OverflowTier{
+			{Teams: []string{"tier1"}},
+			{Teams: []string{"tier2"}, After: 20 * time.Second},
+			{After: time.Minute},
+		})
+		system.SetOverflowChain("account2", []assignmentsystem.OverflowTier{{}})
+		if err := system.StartAudit(assignmentsystem.AuditOptions{Path: auditPath, SampleRate: 1}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	now := start
+	original := assignmentsystem.NewAssignmentSystem(roster)
+	original.SetClock(func() time.Time { return now })
+	originalAudit := filepath.Join(t.TempDir(), "original.jsonl")
+	configure(&original, originalAudit)
+	err := original.SetShifts("tier1_0", []assignmentsystem.Shift{{
+		Start:  start.Add(2 * time.Minute),
+		End:    start.Add(6 * time.Minute),
+		Breaks: []assignmentsystem.Break{{Start: start.Add(4 * time.Minute), End: start.Add(5 * time.Minute)}},
+		Limit:  4,
+	}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var buffer bytes.Buffer
+	if err := original.StartTrace(&buffer); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	random := NewRand(5)
+	var recorded []assignmentsystem.AssignmentResult
+	var active []string
+	waited, reevaluated := 0, 0
+	for tick := range 8 * 60 {
+		now = start.Add(time.Duration(tick) * time.Second)
+		original.ApplyShifts()
+
+		for range random.Intn(3) {
+			if len(active) == 0 {
+				break
+			}
+			k := random.Intn(len(active))
+			if err := original.Complete(active[k]); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			active = append(active[:k], active[k+1:]...)
+		}
+
+		conversations := make([]assignmentsystem.ConversationToAssign, random.Intn(3))
+		for i := range conversations {
+			account := "account1"
+			if random.Intn(4) == 0 {
+				account = "account2"
+			}
+			conversations[i] = assignmentsystem.ConversationToAssign{ConversationID: fmt.Sprintf("conv%d-%d", tick, i), Account: account}
+		}
+		results := original.AssignResults(context.Background(), conversations)
+		for _, result := range results {
+			if result.Waiting {
+				waited++
+			} else if result.Err == nil {
+				active = append(active, result.ConversationID)
+			}
+		}
+		recorded = append(recorded, results...)
+
+		for conversationID := range original.ReevaluateWaiting() {
+			reevaluated++
+			active = append(active, conversationID)
+		}
+	}
+	if err := original.StopTrace(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := original.StopAudit(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Make sure the run went through the overflow chain
+	if waited == 0 || reevaluated == 0 {
+		t.Fatalf("Expected conversations to wait and be re-evaluated, %d waited and %d were re-evaluated", waited, reevaluated)
+	}
+
+	trace, err := assignmentsystem.ReadTrace(&buffer)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	replayed := assignmentsystem.NewAssignmentSystem(trace.Roster)
+	replayedAudit := filepath.Join(t.TempDir(), "replayed.jsonl")
+	configure(&replayed, replayedAudit)
+	var results []assignmentsystem.AssignmentResult
+	err = Replay(context.Background(), &replayed, trace, 0, func(batch assignmentsystem.DispatchedBatch) {
+		results = append(results, batch.Results...)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := replayed.StopAudit(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(results) != len(recorded) {
+		t.Fatalf("Expected %d results, got %d", len(recorded), len(results))
+	}
+	for i := range recorded {
+		if results[i].AgentName != recorded[i].AgentName || results[i].Waiting != recorded[i].Waiting || !errors.Is(results[i].Err, recorded[i].Err) {
+			t.Fatalf("Result %d differs: recorded %+v, replayed %+v", i, recorded[i], results[i])
+		}
+	}
+
+	// Every decision, re-evaluations included, was made the same way
+	originalDecisions, err := os.ReadFile(originalAudit)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	replayedDecisions, err := os.ReadFile(replayedAudit)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !bytes.Equal(originalDecisions, replayedDecisions) {
+		t.Errorf("Expected the replayed decisions to match the recorded ones")
+	}
+
+	var originalState, replayedState bytes.Buffer
+	if err := original.WriteSnapshot(&originalState); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := replayed.WriteSnapshot(&replayedState); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if originalState.String() != replayedState.String() {
+		t.Errorf("Expected the replayed state to match the recorded one")
+	}
+}
+
+func TestReplayPacesOperations(t *testing.T) {
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	trace := &assignmentsystem.Trace{
+		Roster: []assignmentsystem.AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1}},
+		Operations: []assignmentsystem.TraceRecord{
+			{At: start, Op: assignmentsystem.TraceAssign, Conversations: []assignmentsystem.ConversationToAssign{{ConversationID: "conv1", Account: "account1"}}},
+			{At: start.Add(time.Second), Op: assignmentsystem.TraceComplete, ConversationID: "conv1"},
+		},
+	}
+	system := assignmentsystem.NewAssignmentSystem(trace.Roster)
+
+	// A second of trace at 20 times the speed
+	began := time.Now()
+	if err := Replay(context.Background(), &system, trace, 20, func(assignmentsystem.DispatchedBatch) {}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if elapsed := time.Since(began); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected the replay to take about 50ms, took %v", elapsed)
+	}
+}
+
+func TestReplayUnknownAgent(t *testing.T) {
+	trace := &assignmentsystem.Trace{
+		Roster:     []assignmentsystem.AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1}},
+		Operations: []assignmentsystem.TraceRecord{{At: time.Now(), Op: assignmentsystem.TraceSetLimit, AgentName: "agent2", Limit: 3}},
+	}
+	system := assignmentsystem.NewAssignmentSystem(trace.Roster)
+
+	err := Replay(context.Background(), &system, trace, 0, func(assignmentsystem.DispatchedBatch) {})
+	if !errors.Is(err, assignmentsystem.ErrUnknownAgent) {
+		t.Errorf("Expected ErrUnknownAgent, got %v", err)
+	}
+}
@@ -0,0 +1,487 @@
+package loadtest
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+)
+
+// worstAccountsReported is how many accounts a report lists by failure rate
+const worstAccountsReported = 10
+
+// accountSizeBuckets are the upper bounds, in agents, of the account sizes a
+// report breaks results down by. Anything larger falls in a last open bucket.
+var accountSizeBuckets = []int{10, 100, 1000}
+
+// LatencySummary describes a set of latencies
+type LatencySummary struct {
+	Count int           `json:"count"`
+	Mean  time.Duration `json:"mean_ns"`
+	P50   time.Duration `json:"p50_ns"`
+	P90   time.Duration `json:"p90_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+// summariseLatencies sorts latencies in place and summarises them
+func summariseLatencies(latencies []time.Duration) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+
+	slices.Sort(latencies)
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+
+	percentile := func(p int) time.Duration {
+		return latencies[(len(latencies)-1)*p/100]
+	}
+
+	return LatencySummary{
+		Count: len(latencies),
+		Mean:  total / time.Duration(len(latencies)),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P99:   percentile(99),
+		Max:   latencies[len(latencies)-1],
+	}
+}
+
+func (l LatencySummary) String() string {
+	return fmt.Sprintf("mean %v, p50 %v, p90 %v, p99 %v, max %v", l.Mean, l.P50, l.P90, l.P99, l.Max)
+}
+
+// MemorySummary is the process's memory use at the end of a run
+type MemorySummary struct {
+	HeapAlloc    uint64        `json:"heap_alloc_bytes"`
+	TotalAlloc   uint64        `json:"total_alloc_bytes"`
+	Sys          uint64        `json:"sys_bytes"`
+	NumGC        uint32        `json:"num_gc"`
+	GCPauseTotal time.Duration `json:"gc_pause_total_ns"`
+	GCPauseMax   time.Duration `json:"gc_pause_max_ns"` // Over the last 256 collections
+}
+
+func readMemorySummary() MemorySummary {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	summary := MemorySummary{
+		HeapAlloc:    stats.HeapAlloc,
+		TotalAlloc:   stats.TotalAlloc,
+		Sys:          stats.Sys,
+		NumGC:        stats.NumGC,
+		GCPauseTotal: time.Duration(stats.PauseTotalNs),
+	}
+	for _, pause := range stats.PauseNs {
+		summary.GCPauseMax = max(summary.GCPauseMax, time.Duration(pause))
+	}
+
+	return summary
+}
+
+// Outcomes counts what happened to a group of conversations
+type Outcomes struct {
+	Conversations int `json:"conversations"`
+	Assigned      int `json:"assigned"`
+	Waiting       int `json:"waiting"`
+	Failed        int `json:"failed"`
+}
+
+func (o *Outcomes) record(result assignmentsystem.AssignmentResult) {
+	o.Conversations++
+	switch {
+	case result.Err != nil:
+		o.Failed++
+	case result.Waiting:
+		o.Waiting++
+	default:
+		o.Assigned++
+	}
+}
+
+// FailureRate is the share of the conversations that could not be assigned
+func (o Outcomes) FailureRate() float64 {
+	if o.Conversations == 0 {
+		return 0
+	}
+	return float64(o.Failed) / float64(o.Conversations)
+}
+
+// AccountSizeSummary is how accounts of a range of sizes fared
+type AccountSizeSummary struct {
+	MinAgents int `json:"min_agents"`
+	MaxAgents int `json:"max_agents,omitempty"` // Zero for the open ended largest bucket
+	Accounts  int `json:"accounts"`
+	Outcomes
+	Latency LatencySummary `json:"latency"`
+}
+
+func (s AccountSizeSummary) label() string {
+	if s.MaxAgents == 0 {
+		return fmt.Sprintf("%d+ agents", s.MinAgents)
+	}
+	return fmt.Sprintf("%d-%d agents", s.MinAgents, s.MaxAgents)
+}
+
+// AccountSummary is how a single account fared
+type AccountSummary struct {
+	Account string `json:"account"`
+	Agents  int    `json:"agents"`
+	Outcomes
+}
+
+// FairnessSummary is how evenly accounts spread their conversations across
+// their agents. Accounts with a single agent or nothing assigned are left out.
+type FairnessSummary struct {
+	Accounts int     `json:"accounts"`
+	MeanGini float64 `json:"mean_gini"` // Weighted by the accounts' assignments
+	MaxGini  float64 `json:"max_gini"`
+
+	// The accounts with the highest Gini coefficients
+	UnevenAccounts []assignmentsystem.FairnessReport `json:"uneven_accounts,omitempty"`
+}
+
+// SummariseFairness summarises the fairness reports of every account
+func SummariseFairness(reports []assignmentsystem.FairnessReport) FairnessSummary {
+	var summary FairnessSummary
+	var measured []assignmentsystem.FairnessReport
+	assignments := 0
+
+	for _, report := range reports {
+		if report.Agents < 2 || report.Assignments == 0 {
+			continue
+		}
+		measured = append(measured, report)
+		summary.MeanGini += report.Gini * float64(report.Assignments)
+		summary.MaxGini = max(summary.MaxGini, report.Gini)
+		assignments += report.Assignments
+	}
+
+	summary.Accounts = len(measured)
+	if assignments > 0 {
+		summary.MeanGini /= float64(assignments)
+	}
+
+	slices.SortFunc(measured, func(a, b assignmentsystem.FairnessReport) int {
+		if c := cmp.Compare(b.Gini, a.Gini); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Account, b.Account)
+	})
+	summary.UnevenAccounts = measured[:min(len(measured), worstAccountsReported)]
+
+	return summary
+}
+
+// Report describes a load test run. It is written as text for people and as
+// JSON to compare runs and attach to tickets.
+type Report struct {
+	Seed        int64         `json:"seed,omitempty"` // Zero for replayed traces
+	Interrupted bool          `json:"interrupted,omitempty"`
+	Elapsed     time.Duration `json:"elapsed_ns"`
+	Simulated   time.Duration `json:"simulated_ns,omitempty"` // Virtual time covered by a virtual run
+
+	Batches             int `json:"batches"`
+	BatchesWithFailures int `json:"batches_with_failures"`
+	Outcomes
+	FailuresByReason map[string]int `json:"failures_by_reason"`
+
+	// Conversations per second of the run, and per second spent assigning
+	Throughput          float64        `json:"throughput_per_second"`
+	AssignmentRate      float64        `json:"assignment_rate_per_second"`
+	BatchLatency        LatencySummary `json:"batch_latency"`
+	ConversationLatency LatencySummary `json:"conversation_latency"` // From being received to its batch finishing
+
+	Memory        MemorySummary        `json:"memory"`
+	AccountSizes  []AccountSizeSummary `json:"account_sizes"`
+	WorstAccounts []AccountSummary     `json:"worst_accounts,omitempty"`
+	SteadyState   *SteadyStateReport   `json:"steady_state,omitempty"`
+	Fairness      *FairnessSummary     `json:"fairness,omitempty"`
+}
+
+// Recorder collects the batches of a run into a Report. It is not safe for
+// concurrent use.
+type Recorder struct {
+	seed                   int64
+	started                time.Time
+	accountSizes           map[string]int
+	batches                int
+	batchesWithFailures    int
+	outcomes               Outcomes
+	failuresByReason       map[string]int
+	accounts               map[string]*Outcomes
+	totalBatchTime         time.Duration
+	batchLatencies         []time.Duration
+	conversationLatencies  []time.Duration
+	latenciesByAccountSize [][]time.Duration
+	simulated              time.Duration
+	steadyState            *SteadyStateReport
+	fairness               *FairnessSummary
+}
+
+// NewRecorder starts recording a run with the given seed over the roster
+func NewRecorder(seed int64, agents []assignmentsystem.AgentNameAndAccount) *Recorder {
+	recorder := &Recorder{
+		seed:                   seed,
+		started:                time.Now(),
+		accountSizes:           make(map[string]int),
+		failuresByReason:       make(map[string]int),
+		accounts:               make(map[string]*Outcomes),
+		latenciesByAccountSize: make([][]time.Duration, len(accountSizeBuckets)+1),
+	}
+
+	for _, agent := range agents {
+		recorder.accountSizes[agent.Account]++
+	}
+
+	return recorder
+}
+
+// sizeBucket is the index of the account size bucket an account belongs to
+func sizeBucket(agents int) int {
+	bucket, _ := slices.BinarySearch(accountSizeBuckets, agents)
+	return bucket
+}
+
+// Record adds a batch to the run
+func (r *Recorder) Record(batch assignmentsystem.DispatchedBatch) {
+	r.batches++
+	r.totalBatchTime += batch.Duration
+	r.batchLatencies = append(r.batchLatencies, batch.Duration)
+	if batch.Err() != nil {
+		r.batchesWithFailures++
+	}
+
+	finished := batch.Started.Add(batch.Duration)
+	for _, result := range batch.Results {
+		r.outcomes.record(result)
+		if result.Err != nil {
+			r.failuresByReason[result.Err.Error()]++
+		}
+
+		outcomes, ok := r.accounts[result.Account]
+		if !ok {
+			outcomes = &Outcomes{}
+			r.accounts[result.Account] = outcomes
+		}
+		outcomes.record(result)
+
+		// Conversations that didn't go through a Dispatcher arrived with their batch
+		latency := batch.Duration
+		if !result.Received.IsZero() {
+			latency = finished.Sub(result.Received)
+		}
+		r.conversationLatencies = append(r.conversationLatencies, latency)
+
+		bucket := sizeBucket(r.accountSizes[result.Account])
+		r.latenciesByAccountSize[bucket] = append(r.latenciesByAccountSize[bucket], latency)
+	}
+}
+
+// SetSimulated records how much virtual time a virtual run covered
+func (r *Recorder) SetSimulated(simulated time.Duration) {
+	r.simulated = simulated
+}
+
+// SetSteadyState adds a simulation's steady state report to the run
+func (r *Recorder) SetSteadyState(report SteadyStateReport) {
+	r.steadyState = &report
+}
+
+// SetFairness adds the system's fairness reports at the end of the run
+func (r *Recorder) SetFairness(reports []assignmentsystem.FairnessReport) {
+	summary := SummariseFairness(reports)
+	r.fairness = &summary
+}
+
+// Report summarises the run so far, including the process's current memory use
+func (r *Recorder) Report() Report {
+	report := Report{
+		Seed:                r.seed,
+		Elapsed:             time.Since(r.started),
+		Simulated:           r.simulated,
+		Batches:             r.batches,
+		BatchesWithFailures: r.batchesWithFailures,
+		Outcomes:            r.outcomes,
+		FailuresByReason:    maps.Clone(r.failuresByReason),
+		BatchLatency:        summariseLatencies(slices.Clone(r.batchLatencies)),
+		ConversationLatency: summariseLatencies(slices.Clone(r.conversationLatencies)),
+		Memory:              readMemorySummary(),
+		SteadyState:         r.steadyState,
+		Fairness:            r.fairness,
+	}
+
+	if seconds := report.Elapsed.Seconds(); seconds > 0 {
+		report.Throughput = float64(r.outcomes.Conversations) / seconds
+	}
+	if seconds := r.totalBatchTime.Seconds(); seconds > 0 {
+		report.AssignmentRate = float64(r.outcomes.Conversations) / seconds
+	}
+
+	report.AccountSizes = r.accountSizeSummaries()
+	report.WorstAccounts = r.worstAccounts()
+
+	return report
+}
+
+func (r *Recorder) accountSizeSummaries() []AccountSizeSummary {
+	summaries := make([]AccountSizeSummary, len(accountSizeBuckets)+1)
+	for i := range summaries {
+		summaries[i].MinAgents = 1
+		if i > 0 {
+			summaries[i].MinAgents = accountSizeBuckets[i-1] + 1
+		}
+		if i < len(accountSizeBuckets) {
+			summaries[i].MaxAgents = accountSizeBuckets[i]
+		}
+		summaries[i].Latency = summariseLatencies(slices.Clone(r.latenciesByAccountSize[i]))
+	}
+
+	for account, agents := range r.accountSizes {
+		summaries[sizeBucket(agents)].Accounts++
+		if outcomes, ok := r.accounts[account]; ok {
+			bucket := &summaries[sizeBucket(agents)].Outcomes
+			bucket.Conversations += outcomes.Conversations
+			bucket.Assigned += outcomes.Assigned
+			bucket.Waiting += outcomes.Waiting
+			bucket.Failed += outcomes.Failed
+		}
+	}
+
+	return summaries
+}
+
+// worstAccounts lists the accounts that failed the largest share of their
+// conversations, which is where skewed traffic shows up
+func (r *Recorder) worstAccounts() []AccountSummary {
+	var failing []AccountSummary
+	for account, outcomes := range r.accounts {
+		if outcomes.Failed > 0 {
+			failing = append(failing, AccountSummary{Account: account, Agents: r.accountSizes[account], Outcomes: *outcomes})
+		}
+	}
+
+	slices.SortFunc(failing, func(a, b AccountSummary) int {
+		if c := cmp.Compare(b.FailureRate(), a.FailureRate()); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Failed, a.Failed); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Account, b.Account)
+	})
+
+	return failing[:min(len(failing), worstAccountsReported)]
+}
+
+// WriteJSON writes the report as indented JSON
+func (r Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteText writes the report for people to read
+func (r Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintln(&b, "Run report")
+	if r.Interrupted {
+		fmt.Fprintln(&b, "  interrupted:          yes")
+	}
+	if r.Seed != 0 {
+		fmt.Fprintf(&b, "  seed:                 %d\n", r.Seed)
+	}
+	fmt.Fprintf(&b, "  elapsed:              %v\n", r.Elapsed.Round(time.Millisecond))
+	if r.Simulated > 0 {
+		fmt.Fprintf(&b, "  simulated:            %v\n", r.Simulated)
+	}
+	fmt.Fprintf(&b, "  batches:              %d (%d with failures)\n", r.Batches, r.BatchesWithFailures)
+	fmt.Fprintf(&b, "  conversations:        %d (%d assigned, %d waiting, %d failed)\n", r.Conversations, r.Assigned, r.Waiting, r.Failed)
+	for _, reason := range slices.Sorted(maps.Keys(r.FailuresByReason)) {
+		fmt.Fprintf(&b, "    failed (%s): %d\n", reason, r.FailuresByReason[reason])
+	}
+	fmt.Fprintf(&b, "  throughput:           %.1f conversations/s (%.1f/s while assigning)\n", r.Throughput, r.AssignmentRate)
+	fmt.Fprintf(&b, "  batch latency:        %v\n", r.BatchLatency)
+	fmt.Fprintf(&b, "  conversation latency: %v\n", r.ConversationLatency)
+	fmt.Fprintf(&b, "  memory:               %d MiB heap, %d MiB from the OS, %d MiB allocated in total\n",
+		r.Memory.HeapAlloc>>20, r.Memory.Sys>>20, r.Memory.TotalAlloc>>20)
+	fmt.Fprintf(&b, "  gc:                   %d collections, %v paused in total, longest %v\n",
+		r.Memory.NumGC, r.Memory.GCPauseTotal, r.Memory.GCPauseMax)
+
+	fmt.Fprintln(&b, "  by account size:")
+	for _, size := range r.AccountSizes {
+		if size.Accounts == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "    %s: %d accounts, %d conversations, %.2f%% failed, latency %v\n",
+			size.label(), size.Accounts, size.Conversations, 100*size.FailureRate(), size.Latency)
+	}
+
+	if len(r.WorstAccounts) > 0 {
+		fmt.Fprintln(&b, "  accounts with the highest failure rates:")
+		for _, account := range r.WorstAccounts {
+			fmt.Fprintf(&b, "    %s (%d agents): %d of %d failed (%.1f%%)\n",
+				account.Account, account.Agents, account.Failed, account.Conversations, 100*account.FailureRate())
+		}
+	}
+
+	if r.SteadyState != nil {
+		writeSteadyState(&b, *r.SteadyState)
+	}
+	if r.Fairness != nil {
+		writeFairness(&b, *r.Fairness)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeSteadyState reports on a simulation once it reached equilibrium
+func writeSteadyState(w io.Writer, report SteadyStateReport) {
+	fmt.Fprintln(w, "Steady state (after warmup)")
+	if report.Steps == 0 {
+		fmt.Fprintln(w, "  run ended before the warmup did")
+		return
+	}
+
+	fmt.Fprintf(w, "  ticks:                %d\n", report.Steps)
+	fmt.Fprintf(w, "  arrivals:             %d\n", report.Arrivals)
+	fmt.Fprintf(w, "  completed:            %d\n", report.Completed)
+	fmt.Fprintf(w, "  mean utilisation:     %.1f%%\n", 100*report.MeanUtilisation)
+	fmt.Fprintf(w, "  failure rate:         %.2f%%\n", 100*report.FailureRate)
+	fmt.Fprintf(w, "  tick latency:         %v\n", report.StepLatency)
+}
+
+// writeFairness reports on how evenly accounts spread their work
+func writeFairness(w io.Writer, summary FairnessSummary) {
+	fmt.Fprintln(w, "Fairness")
+	if summary.Accounts == 0 {
+		fmt.Fprintln(w, "  no account with several agents was given work")
+		return
+	}
+
+	fmt.Fprintf(w, "  accounts:             %d\n", summary.Accounts)
+	fmt.Fprintf(w, "  mean gini:            %.3f\n", summary.MeanGini)
+	fmt.Fprintf(w, "  max gini:             %.3f\n", summary.MaxGini)
+	fmt.Fprintln(w, "  least even accounts:")
+	for _, account := range summary.UnevenAccounts {
+		maxMin := "-"
+		if account.MaxMinRatio > 0 {
+			maxMin = fmt.Sprintf("%.2f", account.MaxMinRatio)
+		}
+		fmt.Fprintf(w, "    %s (%d agents): gini %.3f, max/min %s, %.1f assignments per agent hour, idle %v ± %v\n",
+			account.Account, account.Agents, account.Gini, maxMin, account.AssignmentsPerAgentHour,
+			account.Idle.Mean.Round(time.Second), account.Idle.StdDev.Round(time.Second))
+	}
+}
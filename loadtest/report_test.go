@@ -0,0 +1,169 @@
+package loadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+)
+
+func TestSummariseLatencies(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		// Out of order on purpose, 1ms to 100ms
+		latencies[i] = time.Duration(100-i) * time.Millisecond
+	}
+
+	summary := summariseLatencies(latencies)
+
+	expected := LatencySummary{
+		Count: 100,
+		Mean:  50500 * time.Microsecond,
+		P50:   50 * time.Millisecond,
+		P90:   90 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+		Max:   100 * time.Millisecond,
+	}
+	if summary != expected {
+		t.Errorf("Expected %+v, got %+v", expected, summary)
+	}
+
+	if empty := summariseLatencies(nil); empty != (LatencySummary{}) {
+		t.Errorf("Expected an empty summary for no latencies, got %+v", empty)
+	}
+}
+
+func TestRecorderReport(t *testing.T) {
+	var agents []assignmentsystem.AgentNameAndAccount
+	for i := range 5 {
+		agents = append(agents, assignmentsystem.AgentNameAndAccount{Name: fmt.Sprintf("small_%d", i), Account: "small", Limit: 1})
+	}
+	for i := range 2000 {
+		agents = append(agents, assignmentsystem.AgentNameAndAccount{Name: fmt.Sprintf("large_%d", i), Account: "large", Limit: 1})
+	}
+
+	recorder := NewRecorder(42, agents)
+	started := time.Now()
+
+	recorder.Record(assignmentsystem.DispatchedBatch{
+		Number:   1,
+		Started:  started,
+		Duration: 2 * time.Millisecond,
+		Results: []assignmentsystem.AssignmentResult{
+			// Waited 8ms in the dispatcher before its batch started
+			{ConversationToAssign: assignmentsystem.ConversationToAssign{ConversationID: "c1", Account: "large"}, AgentName: "large_1", Received: started.Add(-8 * time.Millisecond)},
+			{ConversationToAssign: assignmentsystem.ConversationToAssign{ConversationID: "c2", Account: "small"}, Err: assignmentsystem.ErrNoAvailableAgents},
+		},
+	})
+	recorder.Record(assignmentsystem.DispatchedBatch{
+		Number:   2,
+		Started:  started,
+		Duration: 4 * time.Millisecond,
+		Results: []assignmentsystem.AssignmentResult{
+			{ConversationToAssign: assignmentsystem.ConversationToAssign{ConversationID: "c3", Account: "small"}, AgentName: "small_1"},
+			{ConversationToAssign: assignmentsystem.ConversationToAssign{ConversationID: "c4", Account: "large"}, Waiting: true},
+		},
+	})
+
+	report := recorder.Report()
+
+	if report.Seed != 42 || report.Batches != 2 || report.BatchesWithFailures != 1 {
+		t.Errorf("Unexpected run totals %+v", report)
+	}
+	if report.Outcomes != (Outcomes{Conversations: 4, Assigned: 2, Waiting: 1, Failed: 1}) {
+		t.Errorf("Unexpected outcomes %+v", report.Outcomes)
+	}
+	if report.FailuresByReason[assignmentsystem.ErrNoAvailableAgents.Error()] != 1 {
+		t.Errorf("Expected one failure for no available agents, got %v", report.FailuresByReason)
+	}
+	if report.BatchLatency.Max != 4*time.Millisecond || report.BatchLatency.P50 != 2*time.Millisecond {
+		t.Errorf("Unexpected batch latency %+v", report.BatchLatency)
+	}
+	if report.ConversationLatency.Max != 10*time.Millisecond {
+		t.Errorf("Expected the dispatcher wait in the conversation latency, got %+v", report.ConversationLatency)
+	}
+	// Four conversations in 6ms spent assigning
+	if report.AssignmentRate != 4/(6*time.Millisecond).Seconds() {
+		t.Errorf("Unexpected assignment rate %v", report.AssignmentRate)
+	}
+
+	small := report.AccountSizes[sizeBucket(5)]
+	if small.Accounts != 1 || small.Conversations != 2 || small.Failed != 1 {
+		t.Errorf("Unexpected small account breakdown %+v", small)
+	}
+	large := report.AccountSizes[len(report.AccountSizes)-1]
+	if large.Accounts != 1 || large.Conversations != 2 || large.MaxAgents != 0 || large.Latency.Max != 10*time.Millisecond {
+		t.Errorf("Unexpected large account breakdown %+v", large)
+	}
+
+	if len(report.WorstAccounts) != 1 || report.WorstAccounts[0].Account != "small" || report.WorstAccounts[0].Agents != 5 {
+		t.Errorf("Expected only the small account among the worst, got %+v", report.WorstAccounts)
+	}
+}
+
+func TestReportWriters(t *testing.T) {
+	recorder := NewRecorder(7, []assignmentsystem.AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1}})
+	recorder.Record(assignmentsystem.DispatchedBatch{
+		Number:   1,
+		Started:  time.Now(),
+		Duration: time.Millisecond,
+		Results: []assignmentsystem.AssignmentResult{
+			{ConversationToAssign: assignmentsystem.ConversationToAssign{ConversationID: "c1", Account: "account1"}, Err: assignmentsystem.ErrNoAvailableAgents},
+		},
+	})
+	recorder.SetSteadyState(SteadyStateReport{Steps: 1, Arrivals: 1, Failed: 1, FailureRate: 1})
+	recorder.SetFairness([]assignmentsystem.FairnessReport{{Account: "account1", Agents: 2, Assignments: 4, Gini: 0.25, MaxMinRatio: 3}})
+	report := recorder.Report()
+
+	var buffer bytes.Buffer
+	if err := report.WriteJSON(&buffer); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var decoded Report
+	if err := json.Unmarshal(buffer.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected the report to read back, got %v", err)
+	}
+	if decoded.Seed != 7 || decoded.Failed != 1 || decoded.BatchLatency != report.BatchLatency || decoded.SteadyState == nil || decoded.Fairness == nil {
+		t.Errorf("Expected the report to survive a round trip, got %+v", decoded)
+	}
+
+	buffer.Reset()
+	if err := report.WriteText(&buffer); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, expected := range []string{"seed:                 7", "account1 (1 agents): 1 of 1 failed", "Steady state", "1-10 agents", "account1 (2 agents): gini 0.250, max/min 3.00"} {
+		if !strings.Contains(buffer.String(), expected) {
+			t.Errorf("Expected the text report to contain %q, got\n%s", expected, buffer.String())
+		}
+	}
+}
+
+func TestSummariseFairness(t *testing.T) {
+	summary := SummariseFairness([]assignmentsystem.FairnessReport{
+		{Account: "even", Agents: 4, Assignments: 30, Gini: 0.1},
+		{Account: "uneven", Agents: 3, Assignments: 10, Gini: 0.5},
+		{Account: "single", Agents: 1, Assignments: 50},
+		{Account: "idle", Agents: 5},
+	})
+
+	if summary.Accounts != 2 || summary.MaxGini != 0.5 {
+		t.Errorf("Expected the single agent and idle accounts left out, got %+v", summary)
+	}
+	// Weighted by assignments, (30*0.1 + 10*0.5) / 40
+	if math.Abs(summary.MeanGini-0.2) > 1e-9 {
+		t.Errorf("Expected a mean gini of 0.2, got %v", summary.MeanGini)
+	}
+	if len(summary.UnevenAccounts) != 2 || summary.UnevenAccounts[0].Account != "uneven" {
+		t.Errorf("Expected the least even account first, got %+v", summary.UnevenAccounts)
+	}
+
+	if empty := SummariseFairness(nil); empty.Accounts != 0 || empty.MeanGini != 0 {
+		t.Errorf("Expected an empty summary, got %+v", empty)
+	}
+}
@@ -0,0 +1,420 @@
+package loadtest
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+)
+
+// HandleTimeDistribution is the shape of the time agents spend on a conversation
+type HandleTimeDistribution string
+
+const (
+	// FixedHandleTime handles every conversation in exactly the mean time
+	FixedHandleTime HandleTimeDistribution = "fixed"
+	// ExponentialHandleTime draws handle times with the given mean and no memory
+	ExponentialHandleTime HandleTimeDistribution = "exponential"
+	// LogNormalHandleTime draws handle times with the given mean and standard
+	// deviation and a long tail, which is closest to real conversations
+	LogNormalHandleTime HandleTimeDistribution = "lognormal"
+)
+
+// SimulationOptions describes the lifecycle of conversations and agents in a
+// steady state simulation. Times are in seconds.
+type SimulationOptions struct {
+	HandleTime          HandleTimeDistribution `json:"handle_time"`
+	MeanHandleSeconds   float64                `json:"mean_handle_seconds"`
+	HandleSecondsStdDev float64                `json:"handle_seconds_stddev"` // Only used by the lognormal distribution
+
+	// Agents stay logged in for MeanOnlineSeconds and out for MeanAwaySeconds
+	// on average, both exponentially distributed. Zero MeanOnlineSeconds keeps
+	// every agent logged in.
+	MeanOnlineSeconds float64 `json:"mean_online_seconds"`
+	MeanAwaySeconds   float64 `json:"mean_away_seconds"`
+
+	// Steps in the first WarmupSeconds are left out of the report while the
+	// system fills up to its equilibrium
+	WarmupSeconds float64 `json:"warmup_seconds"`
+
+	// Conversations nobody can take wait for an agent instead of failing,
+	// through an overflow chain open to all of the account's agents
+	QueueWhenFull bool `json:"queue_when_full"`
+}
+
+// DefaultSimulationOptions handles conversations in 5 minutes on average
+// with a long tail, and keeps agents logged in for 4 hours at a time with
+// 15 minute breaks
+func DefaultSimulationOptions() SimulationOptions {
+	return SimulationOptions{
+		HandleTime:          LogNormalHandleTime,
+		MeanHandleSeconds:   300,
+		HandleSecondsStdDev: 300,
+		MeanOnlineSeconds:   4 * 60 * 60,
+		MeanAwaySeconds:     15 * 60,
+		WarmupSeconds:       15 * 60,
+	}
+}
+
+// Validate reports options the simulator can't work with
+func (o SimulationOptions) Validate() error {
+	switch {
+	case !slices.Contains([]HandleTimeDistribution{FixedHandleTime, ExponentialHandleTime, LogNormalHandleTime}, o.HandleTime):
+		return fmt.Errorf("unknown handle time distribution %q", o.HandleTime)
+	case o.MeanHandleSeconds <= 0:
+		return fmt.Errorf("mean handle time must be positive, got %v", o.MeanHandleSeconds)
+	case o.HandleSecondsStdDev < 0:
+		return fmt.Errorf("handle time standard deviation must not be negative, got %v", o.HandleSecondsStdDev)
+	case o.MeanOnlineSeconds < 0:
+		return fmt.Errorf("mean online time must not be negative, got %v", o.MeanOnlineSeconds)
+	case o.MeanOnlineSeconds > 0 && o.MeanAwaySeconds <= 0:
+		return fmt.Errorf("mean away time must be positive when agents log out, got %v", o.MeanAwaySeconds)
+	case o.WarmupSeconds < 0:
+		return fmt.Errorf("warmup must not be negative, got %v", o.WarmupSeconds)
+	}
+
+	return nil
+}
+
+// sampleHandleTime draws how long a conversation takes to handle
+func (o SimulationOptions) sampleHandleTime(random *rand.Rand) time.Duration {
+	var seconds float64
+	switch o.HandleTime {
+	case ExponentialHandleTime:
+		seconds = random.ExpFloat64() * o.MeanHandleSeconds
+	case LogNormalHandleTime:
+		variance := math.Log(1 + (o.HandleSecondsStdDev*o.HandleSecondsStdDev)/(o.MeanHandleSeconds*o.MeanHandleSeconds))
+		mu := math.Log(o.MeanHandleSeconds) - variance/2
+		seconds = math.Exp(mu + math.Sqrt(variance)*random.NormFloat64())
+	default:
+		seconds = o.MeanHandleSeconds
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func sampleExponential(meanSeconds float64, random *rand.Rand) time.Duration {
+	return time.Duration(random.ExpFloat64() * meanSeconds * float64(time.Second))
+}
+
+type simulationEventKind int
+
+const (
+	completionEvent simulationEventKind = iota
+	logoutEvent
+	loginEvent
+)
+
+// simulationEvent is something that happens to a conversation or agent at a
+// given time, the id is the conversation or agent name
+type simulationEvent struct {
+	at   time.Time
+	kind simulationEventKind
+	id   string
+}
+
+// eventQueue is a min-heap of events ordered by time
+type eventQueue []simulationEvent
+
+func (q eventQueue) Len() int           { return len(q) }
+func (q eventQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q eventQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x any)        { *q = append(*q, x.(simulationEvent)) }
+func (q *eventQueue) Pop() any {
+	old := *q
+	event := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return event
+}
+
+// DequeuedConversation is a conversation that waited for an agent and was
+// assigned when one became available
+type DequeuedConversation struct {
+	assignmentsystem.ConversationToAssign
+	AgentName string
+	At        time.Time
+	Waited    time.Duration
+}
+
+// SimulationStep is what happened in one step of a simulation
+type SimulationStep struct {
+	At        time.Time
+	Batch     assignmentsystem.DispatchedBatch // The arrivals of the step
+	Dequeued  []DequeuedConversation           // Waiting conversations assigned since the previous step
+	Completed int
+	LoggedOut int
+	LoggedIn  int
+
+	// State at the end of the step
+	Active         int // Conversations being handled
+	OnlineCapacity int // Sum of the limits of logged in agents
+}
+
+// Utilisation is the share of the logged in agents' capacity in use
+func (s SimulationStep) Utilisation() float64 {
+	if s.OnlineCapacity == 0 {
+		return 0
+	}
+	return float64(s.Active) / float64(s.OnlineCapacity)
+}
+
+// Simulator drives an AssignmentSystem through conversation and agent
+// lifecycles: assigned conversations complete after a sampled handle time and
+// agents log in and out. Conversations left waiting, in accounts with an
+// overflow chain, are retried whenever a conversation completes or an agent
+// logs in. It is not safe for concurrent use and must be the only thing
+// changing the system while it runs.
+type Simulator struct {
+	system   *assignmentsystem.AssignmentSystem
+	options  SimulationOptions
+	random   *rand.Rand
+	limits   map[string]int
+	waiting  map[string]waitingArrival // Keyed by conversation ID
+	events   eventQueue
+	started  time.Time
+	now      time.Time // Time of the event or step being processed
+	steps    int
+	active   int
+	capacity int
+	report   SteadyStateReport
+}
+
+// NewSimulator starts a simulation at the given time with every agent of the
+// roster logged in
+func NewSimulator(system *assignmentsystem.AssignmentSystem, agents []assignmentsystem.AgentNameAndAccount, options SimulationOptions, start time.Time, random *rand.Rand) (*Simulator, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	simulator := &Simulator{
+		system:  system,
+		options: options,
+		random:  random,
+		limits:  make(map[string]int),
+		waiting: make(map[string]waitingArrival),
+		started: start,
+		now:     start,
+	}
+
+	for _, agent := range agents {
+		if options.QueueWhenFull {
+			system.SetOverflowChain(agent.Account, []assignmentsystem.OverflowTier{{}})
+		}
+
+		// Repeated names are one agent in several accounts, the first limit wins
+		if _, ok := simulator.limits[agent.Name]; ok {
+			continue
+		}
+		simulator.limits[agent.Name] = agent.Limit
+		simulator.capacity += agent.Limit
+
+		if options.MeanOnlineSeconds > 0 {
+			simulator.schedule(start.Add(sampleExponential(options.MeanOnlineSeconds, random)), logoutEvent, agent.Name)
+		}
+	}
+
+	return simulator, nil
+}
+
+func (s *Simulator) schedule(at time.Time, kind simulationEventKind, id string) {
+	heap.Push(&s.events, simulationEvent{at: at, kind: kind, id: id})
+}
+
+// NextEvent returns when the next completion, login or logout is due, or
+// false if nothing is scheduled
+func (s *Simulator) NextEvent() (time.Time, bool) {
+	if len(s.events) == 0 {
+		return time.Time{}, false
+	}
+	return s.events[0].at, true
+}
+
+// Step advances the simulation to now: every completion, login and logout due
+// by then happens in time order, then the arrivals are assigned
+func (s *Simulator) Step(ctx context.Context, now time.Time, arrivals []assignmentsystem.ConversationToAssign) (SimulationStep, error) {
+	step := SimulationStep{At: now}
+
+	for len(s.events) > 0 && !s.events[0].at.After(now) {
+		event := heap.Pop(&s.events).(simulationEvent)
+		s.now = event.at
+
+		switch event.kind {
+		case completionEvent:
+			if err := s.system.Complete(event.id); err != nil {
+				return step, err
+			}
+			s.active--
+			step.Completed++
+		case logoutEvent:
+			if err := s.system.SetStatus(event.id, assignmentsystem.AgentOffline); err != nil {
+				return step, err
+			}
+			s.capacity -= s.limits[event.id]
+			step.LoggedOut++
+			s.schedule(event.at.Add(sampleExponential(s.options.MeanAwaySeconds, s.random)), loginEvent, event.id)
+		case loginEvent:
+			if err := s.system.SetStatus(event.id, assignmentsystem.AgentOnline); err != nil {
+				return step, err
+			}
+			s.capacity += s.limits[event.id]
+			step.LoggedIn++
+			s.schedule(event.at.Add(sampleExponential(s.options.MeanOnlineSeconds, s.random)), logoutEvent, event.id)
+		}
+
+		// A slot may have opened up for a waiting conversation
+		if event.kind != logoutEvent && len(s.waiting) > 0 {
+			step.Dequeued = append(step.Dequeued, s.dequeue(event.at)...)
+		}
+	}
+
+	s.now = now
+	s.steps++
+	started := time.Now()
+	results := s.system.AssignResults(ctx, arrivals)
+	step.Batch = assignmentsystem.DispatchedBatch{
+		Number:   s.steps,
+		Results:  results,
+		Started:  started,
+		Duration: time.Since(started),
+	}
+
+	for _, result := range results {
+		switch {
+		case result.Waiting:
+			s.waiting[result.ConversationID] = waitingArrival{ConversationToAssign: result.ConversationToAssign, since: now}
+		case result.Err == nil:
+			s.active++
+			s.schedule(now.Add(s.options.sampleHandleTime(s.random)), completionEvent, result.ConversationID)
+		}
+	}
+
+	step.Active = s.active
+	step.OnlineCapacity = s.capacity
+
+	if now.Sub(s.started).Seconds() >= s.options.WarmupSeconds {
+		s.report.record(step)
+	}
+
+	return step, nil
+}
+
+// waitingArrival is a conversation that arrived while nobody was available
+type waitingArrival struct {
+	assignmentsystem.ConversationToAssign
+	since time.Time
+}
+
+// dequeue retries the waiting conversations and starts handling the ones that
+// were assigned, in the order they arrived in
+func (s *Simulator) dequeue(now time.Time) []DequeuedConversation {
+	assigned := s.system.ReevaluateWaiting()
+	dequeued := make([]DequeuedConversation, 0, len(assigned))
+
+	for conversationID, agentName := range assigned {
+		arrival := s.waiting[conversationID]
+		delete(s.waiting, conversationID)
+		dequeued = append(dequeued, DequeuedConversation{
+			ConversationToAssign: arrival.ConversationToAssign,
+			AgentName:            agentName,
+			At:                   now,
+			Waited:               now.Sub(arrival.since),
+		})
+	}
+
+	// The system returns a map, sort it so the handle times drawn don't
+	// depend on map order
+	slices.SortFunc(dequeued, func(a, b DequeuedConversation) int {
+		if c := cmp.Compare(b.Waited, a.Waited); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ConversationID, b.ConversationID)
+	})
+	for _, conversation := range dequeued {
+		s.active++
+		s.schedule(now.Add(s.options.sampleHandleTime(s.random)), completionEvent, conversation.ConversationID)
+	}
+
+	return dequeued
+}
+
+// RunVirtual plays the traffic through the simulation on a virtual clock,
+// assigning one slice of arrivals every tick from the simulation's start.
+// Completions, logins and logouts in between happen at their own times, so a
+// simulated day takes only as long as the work itself. The system is left
+// reading the simulation's clock. onStep is called after every step.
+func (s *Simulator) RunVirtual(ctx context.Context, traffic [][]assignmentsystem.ConversationToAssign, tick time.Duration, onStep func(SimulationStep)) error {
+	s.system.SetClock(func() time.Time { return s.now })
+
+	for i, arrivals := range traffic {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// A step that has started is finished even if ctx is done meanwhile
+		step, err := s.Step(context.WithoutCancel(ctx), s.started.Add(time.Duration(i)*tick), arrivals)
+		if err != nil {
+			return err
+		}
+		onStep(step)
+	}
+
+	return nil
+}
+
+// Report summarises the steps taken since the warmup ended
+func (s *Simulator) Report() SteadyStateReport {
+	report := s.report
+	report.stepDurations = nil
+	report.StepLatency = summariseLatencies(slices.Clone(s.report.stepDurations))
+	if report.Steps > 0 {
+		report.MeanUtilisation = report.totalUtilisation / float64(report.Steps)
+	}
+	if report.Arrivals > 0 {
+		report.FailureRate = float64(report.Failed) / float64(report.Arrivals)
+	}
+
+	return report
+}
+
+// SteadyStateReport is how the system behaved once it reached equilibrium
+type SteadyStateReport struct {
+	Steps     int `json:"steps"`
+	Arrivals  int `json:"arrivals"`
+	Assigned  int `json:"assigned"`
+	Waiting   int `json:"waiting"`
+	Failed    int `json:"failed"`
+	Completed int `json:"completed"`
+
+	MeanUtilisation float64        `json:"mean_utilisation"` // Average share of online capacity in use per step
+	FailureRate     float64        `json:"failure_rate"`     // Share of arrivals that could not be assigned
+	StepLatency     LatencySummary `json:"step_latency"`     // Time taken to assign a step's arrivals
+
+	totalUtilisation float64
+	stepDurations    []time.Duration
+}
+
+func (r *SteadyStateReport) record(step SimulationStep) {
+	r.Steps++
+	r.Completed += step.Completed
+	r.totalUtilisation += step.Utilisation()
+	r.stepDurations = append(r.stepDurations, step.Batch.Duration)
+
+	for _, result := range step.Batch.Results {
+		r.Arrivals++
+		switch {
+		case result.Err != nil:
+			r.Failed++
+		case result.Waiting:
+			r.Waiting++
+		default:
+			r.Assigned++
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+)
+
+func arrivals(from, count int, account string) []assignmentsystem.ConversationToAssign {
+	conversations := make([]assignmentsystem.ConversationToAssign, count)
+	for i := range conversations {
+		conversations[i] = assignmentsystem.ConversationToAssign{ConversationID: fmt.Sprintf("conversation-%d", from+i), Account: account}
+	}
+	return conversations
+}
+
+func TestSimulatorCompletesConversations(t *testing.T) {
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	agents := []assignmentsystem.AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1}}
+	system := assignmentsystem.NewAssignmentSystem(agents)
+
+	options := SimulationOptions{HandleTime: FixedHandleTime, MeanHandleSeconds: 60}
+	simulator, err := NewSimulator(&system, agents, options, start, NewRand(1))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	steps := []struct {
+		at              time.Duration
+		expectAssigned  bool
+		expectCompleted int
+	}{
+		{at: 0, expectAssigned: true},
+		// Still handling the first conversation
+		{at: 59 * time.Second, expectAssigned: false},
+		// The first conversation completes before the arrival is assigned
+		{at: 60 * time.Second, expectAssigned: true, expectCompleted: 1},
+	}
+
+	for i, tt := range steps {
+		step, err := simulator.Step(context.Background(), start.Add(tt.at), arrivals(i+1, 1, "account1"))
+		if err != nil {
+			t.Fatalf("Step %d: expected no error, got %v", i, err)
+		}
+
+		if assigned := step.Batch.Results[0].Err == nil; assigned != tt.expectAssigned {
+			t.Errorf("Step %d: expected assigned %v, got error %v", i, tt.expectAssigned, step.Batch.Results[0].Err)
+		}
+		if step.Completed != tt.expectCompleted {
+			t.Errorf("Step %d: expected %d completed, got %d", i, tt.expectCompleted, step.Completed)
+		}
+		if step.Utilisation() != 1 {
+			t.Errorf("Step %d: expected full utilisation, got %v", i, step.Utilisation())
+		}
+	}
+
+	report := simulator.Report()
+	if report.Arrivals != 3 || report.Assigned != 2 || report.Failed != 1 || report.Completed != 1 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+func TestSimulatorDequeuesWaitingConversations(t *testing.T) {
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	agents := []assignmentsystem.AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1}}
+	system := assignmentsystem.NewAssignmentSystem(agents)
+	system.SetOverflowChain("account1", []assignmentsystem.OverflowTier{{}})
+
+	options := SimulationOptions{HandleTime: FixedHandleTime, MeanHandleSeconds: 60}
+	simulator, err := NewSimulator(&system, agents, options, start, NewRand(1))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	step, err := simulator.Step(context.Background(), start, arrivals(1, 3, "account1"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !step.Batch.Results[1].Waiting || !step.Batch.Results[2].Waiting {
+		t.Fatalf("Expected the second and third conversations to wait, got %+v", step.Batch.Results)
+	}
+
+	// The first completes at 60s and the second takes its place, the third
+	// gets the agent at 120s
+	step, err = simulator.Step(context.Background(), start.Add(130*time.Second), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(step.Dequeued) != 2 || step.Completed != 2 || step.Active != 1 {
+		t.Fatalf("Expected both waiting conversations dequeued, got %+v", step)
+	}
+	for i, expected := range []time.Duration{60 * time.Second, 120 * time.Second} {
+		dequeued := step.Dequeued[i]
+		if dequeued.ConversationID != fmt.Sprintf("conversation-%d", i+2) || dequeued.Waited != expected || dequeued.AgentName != "agent1" {
+			t.Errorf("Expected conversation-%d to wait %v, got %+v", i+2, expected, dequeued)
+		}
+	}
+}
+
+func TestSimulatorLogsAgentsOut(t *testing.T) {
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	agents := []assignmentsystem.AgentNameAndAccount{
+		{Name: "agent1", Account: "account1", Limit: 2},
+		{Name: "agent2", Account: "account1", Limit: 3},
+	}
+	system := assignmentsystem.NewAssignmentSystem(agents)
+
+	// Agents log out within seconds and don't come back for a very long time
+	options := SimulationOptions{
+		HandleTime:        ExponentialHandleTime,
+		MeanHandleSeconds: 60,
+		MeanOnlineSeconds: 1,
+		MeanAwaySeconds:   1e9,
+	}
+	simulator, err := NewSimulator(&system, agents, options, start, NewRand(1))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	step, err := simulator.Step(context.Background(), start.Add(time.Hour), arrivals(1, 1, "account1"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if step.LoggedOut != 2 || step.OnlineCapacity != 0 {
+		t.Errorf("Expected both agents to log out, got %d logged out and capacity %d", step.LoggedOut, step.OnlineCapacity)
+	}
+	if step.Batch.Err() == nil {
+		t.Errorf("Expected the arrival to fail with every agent logged out")
+	}
+	if next, ok := simulator.NextEvent(); !ok || !next.After(start.Add(time.Hour)) {
+		t.Errorf("Expected the logins to be scheduled, got %v", next)
+	}
+}
+
+func TestSimulatorWarmup(t *testing.T) {
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	agents := []assignmentsystem.AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 100}}
+	system := assignmentsystem.NewAssignmentSystem(agents)
+
+	options := SimulationOptions{HandleTime: LogNormalHandleTime, MeanHandleSeconds: 5, HandleSecondsStdDev: 5, WarmupSeconds: 10}
+	simulator, err := NewSimulator(&system, agents, options, start, NewRand(1))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for second := range 20 {
+		if _, err := simulator.Step(context.Background(), start.Add(time.Duration(second)*time.Second), arrivals(second*2+1, 2, "account1")); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	report := simulator.Report()
+	if report.Steps != 10 || report.Arrivals != 20 {
+		t.Errorf("Expected the 10 steps after the warmup, got %d steps with %d arrivals", report.Steps, report.Arrivals)
+	}
+	if report.MeanUtilisation <= 0 || report.MeanUtilisation > 1 {
+		t.Errorf("Expected utilisation between 0 and 1, got %v", report.MeanUtilisation)
+	}
+}
+
+func TestSimulatorRunVirtual(t *testing.T) {
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	agents := []assignmentsystem.AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1}}
+	system := assignmentsystem.NewAssignmentSystem(agents)
+
+	options := SimulationOptions{HandleTime: FixedHandleTime, MeanHandleSeconds: 120}
+	simulator, err := NewSimulator(&system, agents, options, start, NewRand(1))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// One arrival a minute, each conversation takes two
+	traffic := make([][]assignmentsystem.ConversationToAssign, 6)
+	for i := range traffic {
+		traffic[i] = arrivals(i+1, 1, "account1")
+	}
+
+	var steps []SimulationStep
+	err = simulator.RunVirtual(context.Background(), traffic, time.Minute, func(step SimulationStep) {
+		steps = append(steps, step)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(steps) != 6 {
+		t.Fatalf("Expected 6 steps, got %d", len(steps))
+	}
+	for i, step := range steps {
+		if expected := start.Add(time.Duration(i) * time.Minute); !step.At.Equal(expected) {
+			t.Errorf("Step %d: expected it at %v, got %v", i, expected, step.At)
+		}
+		if assigned, expected := step.Batch.Err() == nil, i%2 == 0; assigned != expected {
+			t.Errorf("Step %d: expected assigned %v, got %v", i, expected, assigned)
+		}
+	}
+
+	// The system's clock follows the simulation
+	var snapshot bytes.Buffer
+	if err := system.WriteSnapshot(&snapshot); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(snapshot.String(), start.Add(5*time.Minute).Format(time.RFC3339)) {
+		t.Errorf("Expected the snapshot to be taken at the simulated time, got %s", snapshot.String())
+	}
+}
+
+func TestSimulatorRunVirtualCancelled(t *testing.T) {
+	agents := []assignmentsystem.AgentNameAndAccount{{Name: "agent1", Account: "account1", Limit: 1}}
+	system := assignmentsystem.NewAssignmentSystem(agents)
+
+	simulator, err := NewSimulator(&system, agents, DefaultSimulationOptions(), time.Now(), NewRand(1))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	steps := 0
+	err = simulator.RunVirtual(ctx, make([][]assignmentsystem.ConversationToAssign, 10), time.Second, func(SimulationStep) {
+		steps++
+		if steps == 3 {
+			cancel()
+		}
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if steps != 3 {
+		t.Errorf("Expected 3 steps before stopping, got %d", steps)
+	}
+}
+
+func TestSimulationOptionsValidate(t *testing.T) {
+	if err := DefaultSimulationOptions().Validate(); err != nil {
+		t.Errorf("Expected default options to be valid, got %v", err)
+	}
+
+	invalid := DefaultSimulationOptions()
+	invalid.HandleTime = "gamma"
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected an error for an unknown handle time distribution")
+	}
+
+	invalid = DefaultSimulationOptions()
+	invalid.MeanAwaySeconds = 0
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected an error for agents that log out and never come back")
+	}
+}
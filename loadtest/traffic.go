@@ -0,0 +1,220 @@
+package loadtest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+)
+
+// AccountDistribution decides how traffic is spread across accounts
+type AccountDistribution string
+
+const (
+	// UniformDistribution gives every account the same share of traffic
+	UniformDistribution AccountDistribution = "uniform"
+	// SizeDistribution gives accounts traffic in proportion to their number of agents
+	SizeDistribution AccountDistribution = "size"
+	// ZipfDistribution ranks accounts by popularity in a random order and gives
+	// the account at rank k a share proportional to 1/k^ZipfExponent
+	ZipfDistribution AccountDistribution = "zipf"
+)
+
+// TrafficOptions describes how generated conversations are spread across
+// accounts and over time. Time is measured in ticks, the load test runner
+// uses one second ticks.
+type TrafficOptions struct {
+	Distribution AccountDistribution `json:"distribution"`
+	ZipfExponent float64             `json:"zipf_exponent"`
+
+	// Weights supplies the distribution directly and takes precedence over
+	// Distribution when set. Accounts that aren't listed get no traffic.
+	Weights map[string]float64 `json:"weights,omitempty"`
+
+	// A daily cycle of DayTicks ticks peaking at PeakTick. The rate swings
+	// between (1-DiurnalAmplitude) and (1+DiurnalAmplitude) times the base
+	// rate, zero DayTicks turns it off.
+	DayTicks         int     `json:"day_ticks"`
+	PeakTick         int     `json:"peak_tick"`
+	DiurnalAmplitude float64 `json:"diurnal_amplitude"`
+
+	// Each tick starts a burst with BurstProbability, multiplying the rate
+	// by BurstMultiplier for BurstTicks ticks
+	BurstProbability float64 `json:"burst_probability"`
+	BurstMultiplier  float64 `json:"burst_multiplier"`
+	BurstTicks       int     `json:"burst_ticks"`
+}
+
+// DefaultTrafficOptions spreads traffic by account size at a constant rate
+func DefaultTrafficOptions() TrafficOptions {
+	return TrafficOptions{
+		Distribution:    SizeDistribution,
+		ZipfExponent:    1,
+		BurstMultiplier: 1,
+	}
+}
+
+// Validate reports options the traffic generator can't work with
+func (o TrafficOptions) Validate() error {
+	switch {
+	case !slices.Contains([]AccountDistribution{UniformDistribution, SizeDistribution, ZipfDistribution}, o.Distribution):
+		return fmt.Errorf("unknown distribution %q", o.Distribution)
+	case o.Distribution == ZipfDistribution && o.ZipfExponent <= 0:
+		return fmt.Errorf("zipf exponent must be positive, got %v", o.ZipfExponent)
+	case o.DayTicks < 0:
+		return fmt.Errorf("day ticks must not be negative, got %d", o.DayTicks)
+	case o.DiurnalAmplitude < 0 || o.DiurnalAmplitude > 1:
+		return fmt.Errorf("diurnal amplitude must be between 0 and 1, got %v", o.DiurnalAmplitude)
+	case o.BurstProbability < 0 || o.BurstProbability > 1:
+		return fmt.Errorf("burst probability must be between 0 and 1, got %v", o.BurstProbability)
+	case o.BurstMultiplier < 0:
+		return fmt.Errorf("burst multiplier must not be negative, got %v", o.BurstMultiplier)
+	case o.BurstTicks < 0:
+		return fmt.Errorf("burst ticks must not be negative, got %d", o.BurstTicks)
+	}
+
+	for account, weight := range o.Weights {
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return fmt.Errorf("invalid weight %v for account %s", weight, account)
+		}
+	}
+
+	return nil
+}
+
+// AccountPicker draws accounts according to fixed weights
+type AccountPicker struct {
+	accounts   []string
+	cumulative []float64
+}
+
+// NewAccountPicker returns a picker that draws accounts[i] with probability
+// proportional to weights[i]
+func NewAccountPicker(accounts []string, weights []float64) (*AccountPicker, error) {
+	if len(accounts) != len(weights) {
+		return nil, fmt.Errorf("got %d weights for %d accounts", len(weights), len(accounts))
+	}
+
+	picker := &AccountPicker{
+		accounts:   make([]string, 0, len(accounts)),
+		cumulative: make([]float64, 0, len(accounts)),
+	}
+
+	total := 0.0
+	for i, weight := range weights {
+		if weight <= 0 {
+			continue
+		}
+		total += weight
+		picker.accounts = append(picker.accounts, accounts[i])
+		picker.cumulative = append(picker.cumulative, total)
+	}
+
+	if total == 0 {
+		return nil, errors.New("no account has any weight")
+	}
+
+	return picker, nil
+}
+
+// Pick draws one account
+func (p *AccountPicker) Pick(random *rand.Rand) string {
+	target := random.Float64() * p.cumulative[len(p.cumulative)-1]
+	return p.accounts[sort.SearchFloat64s(p.cumulative, target)]
+}
+
+// AccountWeights works out each account's share of traffic under options,
+// returning the accounts in the order they first appear in the roster
+func AccountWeights(agents []assignmentsystem.AgentNameAndAccount, options TrafficOptions, random *rand.Rand) ([]string, []float64) {
+	sizes := make(map[string]int)
+	var accounts []string
+	for _, agent := range agents {
+		if sizes[agent.Account] == 0 {
+			accounts = append(accounts, agent.Account)
+		}
+		sizes[agent.Account]++
+	}
+
+	weights := make([]float64, len(accounts))
+	switch {
+	case options.Weights != nil:
+		for i, account := range accounts {
+			weights[i] = options.Weights[account]
+		}
+	case options.Distribution == SizeDistribution:
+		for i, account := range accounts {
+			weights[i] = float64(sizes[account])
+		}
+	case options.Distribution == ZipfDistribution:
+		for rank, i := range random.Perm(len(accounts)) {
+			weights[i] = 1 / math.Pow(float64(rank+1), options.ZipfExponent)
+		}
+	default:
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+
+	return accounts, weights
+}
+
+// TickVolumes returns how many conversations arrive in each of the given
+// number of ticks, starting from baseRate and applying the daily cycle and
+// bursts
+func TickVolumes(baseRate int, ticks int, options TrafficOptions, random *rand.Rand) []int {
+	volumes := make([]int, ticks)
+	burstTicksLeft := 0
+
+	for tick := range ticks {
+		rate := float64(baseRate)
+
+		if options.DayTicks > 0 {
+			phase := 2 * math.Pi * float64(tick-options.PeakTick) / float64(options.DayTicks)
+			rate *= 1 + options.DiurnalAmplitude*math.Cos(phase)
+		}
+
+		if burstTicksLeft == 0 && options.BurstTicks > 0 && random.Float64() < options.BurstProbability {
+			burstTicksLeft = options.BurstTicks
+		}
+		if burstTicksLeft > 0 {
+			rate *= options.BurstMultiplier
+			burstTicksLeft--
+		}
+
+		volumes[tick] = int(math.Round(rate))
+	}
+
+	return volumes
+}
+
+// GenerateTraffic creates the conversations arriving in each tick for the
+// given roster, numbering them in arrival order
+func GenerateTraffic(agents []assignmentsystem.AgentNameAndAccount, baseRate int, ticks int, options TrafficOptions, random *rand.Rand) ([][]assignmentsystem.ConversationToAssign, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	picker, err := NewAccountPicker(AccountWeights(agents, options, random))
+	if err != nil {
+		return nil, err
+	}
+
+	traffic := make([][]assignmentsystem.ConversationToAssign, ticks)
+	conversationID := 1
+	for tick, volume := range TickVolumes(baseRate, ticks, options, random) {
+		traffic[tick] = make([]assignmentsystem.ConversationToAssign, volume)
+		for i := range volume {
+			traffic[tick][i] = assignmentsystem.ConversationToAssign{
+				ConversationID: fmt.Sprintf("conversation-%d", conversationID),
+				Account:        picker.Pick(random),
+			}
+			conversationID++
+		}
+	}
+
+	return traffic, nil
+}
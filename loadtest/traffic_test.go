@@ -0,0 +1,166 @@
+package loadtest
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/flygerian/assignment-system/assignmentsystem"
+)
+
+func trafficRoster() []assignmentsystem.AgentNameAndAccount {
+	var agents []assignmentsystem.AgentNameAndAccount
+	for i := range 90 {
+		agents = append(agents, assignmentsystem.AgentNameAndAccount{Name: fmt.Sprintf("big_%d", i), Account: "big", Limit: 5})
+	}
+	for i := range 10 {
+		agents = append(agents, assignmentsystem.AgentNameAndAccount{Name: fmt.Sprintf("small_%d", i), Account: "small", Limit: 5})
+	}
+	return agents
+}
+
+func countByAccount(traffic [][]assignmentsystem.ConversationToAssign) (map[string]int, int) {
+	counts := make(map[string]int)
+	total := 0
+	for _, tick := range traffic {
+		for _, conversation := range tick {
+			counts[conversation.Account]++
+			total++
+		}
+	}
+	return counts, total
+}
+
+func TestGenerateTrafficDistributions(t *testing.T) {
+	tests := []struct {
+		name          string
+		options       func(*TrafficOptions)
+		expectedShare float64 // Share of the traffic expected for the big account
+	}{
+		{name: "uniform", options: func(o *TrafficOptions) { o.Distribution = UniformDistribution }, expectedShare: 0.5},
+		{name: "size", options: func(o *TrafficOptions) { o.Distribution = SizeDistribution }, expectedShare: 0.9},
+		{name: "weights", options: func(o *TrafficOptions) { o.Weights = map[string]float64{"big": 1, "small": 3} }, expectedShare: 0.25},
+		{name: "weights leave out an account", options: func(o *TrafficOptions) { o.Weights = map[string]float64{"big": 1} }, expectedShare: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultTrafficOptions()
+			tt.options(&options)
+
+			traffic, err := GenerateTraffic(trafficRoster(), 100, 100, options, NewRand(1))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			counts, total := countByAccount(traffic)
+			if total != 10_000 {
+				t.Errorf("Expected 10,000 conversations, got %d", total)
+			}
+
+			share := float64(counts["big"]) / float64(total)
+			if math.Abs(share-tt.expectedShare) > 0.02 {
+				t.Errorf("Expected the big account to get %.2f of the traffic, got %.2f", tt.expectedShare, share)
+			}
+		})
+	}
+}
+
+func TestAccountWeightsZipf(t *testing.T) {
+	var agents []assignmentsystem.AgentNameAndAccount
+	for i := range 4 {
+		agents = append(agents, assignmentsystem.AgentNameAndAccount{Name: fmt.Sprintf("agent_%d", i), Account: fmt.Sprintf("account_%d", i)})
+	}
+
+	options := DefaultTrafficOptions()
+	options.Distribution = ZipfDistribution
+	options.ZipfExponent = 2
+
+	accounts, weights := AccountWeights(agents, options, NewRand(1))
+	if len(accounts) != 4 {
+		t.Fatalf("Expected 4 accounts, got %d", len(accounts))
+	}
+
+	slices.Sort(weights)
+	expected := []float64{1.0 / 16, 1.0 / 9, 1.0 / 4, 1}
+	for i := range expected {
+		if math.Abs(weights[i]-expected[i]) > 1e-9 {
+			t.Errorf("Expected weights %v, got %v", expected, weights)
+			break
+		}
+	}
+}
+
+func TestTickVolumes(t *testing.T) {
+	options := DefaultTrafficOptions()
+	options.DayTicks = 24
+	options.PeakTick = 12
+	options.DiurnalAmplitude = 0.5
+
+	volumes := TickVolumes(100, 48, options, NewRand(1))
+
+	if volumes[12] != 150 || volumes[36] != 150 {
+		t.Errorf("Expected 150 conversations at the peaks, got %d and %d", volumes[12], volumes[36])
+	}
+	if volumes[0] != 50 || volumes[24] != 50 {
+		t.Errorf("Expected 50 conversations in the troughs, got %d and %d", volumes[0], volumes[24])
+	}
+
+	options = DefaultTrafficOptions()
+	options.BurstProbability = 1
+	options.BurstMultiplier = 3
+	options.BurstTicks = 2
+
+	for tick, volume := range TickVolumes(10, 5, options, NewRand(1)) {
+		if volume != 30 {
+			t.Errorf("Expected every tick to be in a burst, got %d conversations in tick %d", volume, tick)
+		}
+	}
+}
+
+func TestGenerateTrafficReplays(t *testing.T) {
+	options := DefaultTrafficOptions()
+	options.Distribution = ZipfDistribution
+	options.BurstProbability = 0.1
+	options.BurstMultiplier = 4
+	options.BurstTicks = 3
+
+	first, err := GenerateTraffic(trafficRoster(), 20, 50, options, NewRand(7))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	second, _ := GenerateTraffic(trafficRoster(), 20, 50, options, NewRand(7))
+
+	if !slices.EqualFunc(first, second, slices.Equal) {
+		t.Errorf("Expected the same traffic for the same seed")
+	}
+}
+
+func TestTrafficOptionsValidate(t *testing.T) {
+	if err := DefaultTrafficOptions().Validate(); err != nil {
+		t.Errorf("Expected default options to be valid, got %v", err)
+	}
+
+	invalid := DefaultTrafficOptions()
+	invalid.Distribution = "normal"
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected an error for an unknown distribution")
+	}
+
+	invalid = DefaultTrafficOptions()
+	invalid.DiurnalAmplitude = 2
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected an error for a diurnal amplitude above 1")
+	}
+
+	invalid = DefaultTrafficOptions()
+	invalid.Weights = map[string]float64{"account": -1}
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected an error for a negative weight")
+	}
+
+	if _, err := GenerateTraffic(trafficRoster(), 1, 1, TrafficOptions{Distribution: UniformDistribution, Weights: map[string]float64{"missing": 1}}, NewRand(1)); err == nil {
+		t.Errorf("Expected an error when no account in the roster has weight")
+	}
+}